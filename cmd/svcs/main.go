@@ -86,7 +86,7 @@ func initialize(c *cli.Context) error {
 
 	for _, svc := range cfg {
 		log.Infof("Starting: %s %s", svc.Name, svc.Cmd)
-		mgr.Start(svc.Name, svc.Cmd, svc.Dir, os.Environ())
+		mgr.StartArgs(svc.Name, svc.Cmd.Args(svc.Shell), svc.Dir, os.Environ())
 	}
 
 	return mgr.Watch()
@@ -3,9 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"syscall"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/ionrock/xenv/config"
+	"github.com/ionrock/xenv/reaper"
 	"github.com/urfave/cli"
 )
 
@@ -19,6 +22,12 @@ func XeAction(c *cli.Context) error {
 		log.SetLevel(log.DebugLevel)
 	}
 
+	// In init mode xenv runs again as a child of the reaper.
+	if c.Bool("init") && !reaper.IsChild() {
+		os.Exit(reaper.Run(os.Args))
+	}
+	os.Unsetenv(reaper.ChildEnv)
+
 	logCtx := log.WithFields(log.Fields{
 		"config": c.String("config"),
 	})
@@ -29,19 +38,129 @@ func XeAction(c *cli.Context) error {
 		return err
 	}
 	env.DataOnly = c.Bool("data")
+	log.AddHook(config.NewRedactHook(env.Config))
 
 	if c.Bool("data") {
 		err = env.Pre()
 		if err != nil {
 			return err
 		}
-		for _, pair := range env.Config.ToEnv() {
+		for _, pair := range env.Config.RedactedEnv() {
 			fmt.Println(pair)
 		}
 		return nil
 	}
 
-	return env.Main(c.Args())
+	err = env.Main(c.Args())
+	if err != nil {
+		return exitError(err)
+	}
+	return nil
+}
+
+// exitError exits with the exit code of the command when it failed, or
+// 1 for any other error.
+func exitError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return cli.NewExitError("", reaper.ExitCode(status))
+		}
+	}
+	return cli.NewExitError(err.Error(), 1)
+}
+
+// configPath returns the config flag of a subcommand, falling back to
+// the global flag.
+func configPath(c *cli.Context) string {
+	if c.IsSet("config") || !c.GlobalIsSet("config") {
+		return c.String("config")
+	}
+	return c.GlobalString("config")
+}
+
+// ValidateAction checks the config file and any included files
+// without running anything.
+func ValidateAction(c *cli.Context) error {
+	path := configPath(c)
+
+	_, err := config.LoadXeConfig(path)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("%s is valid\n", path)
+	return nil
+}
+
+// PlanAction prints the steps the config would perform without
+// rendering templates, starting services or running tasks.
+func PlanAction(c *cli.Context) error {
+	if c.GlobalBool("debug") {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	env, err := config.NewEnvironmentFromConfig(configPath(c))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	env.Planning = true
+	env.NoExec = c.Bool("no-exec")
+	log.AddHook(config.NewRedactHook(env.Config))
+
+	err = env.Pre()
+	if err == nil {
+		err = env.Post()
+	}
+
+	// The steps planned before an error are written too.
+	werr := config.WritePlan(os.Stdout, env.Plan)
+	if err == nil {
+		err = werr
+	}
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
+}
+
+// ExplainAction computes the config data and prints where a key's
+// value came from, including the values it overrode.
+func ExplainAction(c *cli.Context) error {
+	if c.GlobalBool("debug") {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	key := c.Args().First()
+	if key == "" {
+		return cli.NewExitError("need a key to explain", 1)
+	}
+
+	env, err := config.NewEnvironmentFromConfig(configPath(c))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	env.DataOnly = true
+	log.AddHook(config.NewRedactHook(env.Config))
+
+	err = env.Pre()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	sources := env.Config.Explain(key)
+	if len(sources) == 0 {
+		return cli.NewExitError(fmt.Sprintf("%s is not set", key), 1)
+	}
+
+	fmt.Printf("%s=%s\n", key, env.Config.Redact(key, env.Config.GetConfig(key)))
+	for i, src := range sources {
+		redacted := *src
+		redacted.Value = env.Config.Redact(key, src.Value)
+		fmt.Printf("  %d. %s\n", i+1, &redacted)
+	}
+
+	return nil
 }
 
 func main() {
@@ -54,12 +173,14 @@ func main() {
 	app.ArgsUsage = "[COMMAND]"
 	app.Action = XeAction
 
+	configFlag := cli.StringFlag{
+		Name:  "config, c",
+		Usage: "Path to the xe config file, default is ./xe.yml",
+		Value: "xe.yml",
+	}
+
 	app.Flags = []cli.Flag{
-		cli.StringFlag{
-			Name:  "config, c",
-			Usage: "Path to the xe config file, default is ./xe.yml",
-			Value: "xe.yml",
-		},
+		configFlag,
 
 		cli.BoolFlag{
 			Name:  "data, d",
@@ -70,6 +191,39 @@ func main() {
 			Name:  "debug, D",
 			Usage: "Print debugging output.",
 		},
+
+		cli.BoolFlag{
+			Name:  "init",
+			Usage: "Run as an init process that reaps zombies, for use as PID 1.",
+		},
+	}
+
+	app.Commands = []cli.Command{
+		{
+			Name:   "validate",
+			Usage:  "Check the config file without running anything.",
+			Flags:  []cli.Flag{configFlag},
+			Action: ValidateAction,
+		},
+		{
+			Name:  "plan",
+			Usage: "Print the steps the config would perform.",
+			Flags: []cli.Flag{
+				configFlag,
+				cli.BoolFlag{
+					Name:  "no-exec, n",
+					Usage: "Don't run commands for values and envscripts.",
+				},
+			},
+			Action: PlanAction,
+		},
+		{
+			Name:      "explain",
+			Usage:     "Print where the value of a key came from.",
+			ArgsUsage: "KEY",
+			Flags:     []cli.Flag{configFlag},
+			Action:    ExplainAction,
+		},
 	}
 
 	app.Run(os.Args)
@@ -4,17 +4,43 @@ import (
 	"fmt"
 	"os"
 	"sort"
-	"strings"
+	"sync"
 )
 
 // Config provides a managed map that provides configuration for an Environment.
 type Config struct {
 	Data map[string]string
+
+	// History keeps the sources of each key in the order they were
+	// set, so the last source is the current value.
+	History map[string][]*Source
+
+	secrets        map[string]bool
+	secretPatterns []string
+
+	// structured is the data of envfiles, envscripts and registered
+	// task output before it was flattened.
+	structured map[string]interface{}
+
+	// lock allows steps that run at the same time to share the
+	// Config.
+	lock sync.RWMutex
+}
+
+// NewConfig creates an empty *Config.
+func NewConfig() *Config {
+	return &Config{
+		Data:    make(map[string]string),
+		History: make(map[string][]*Source),
+	}
 }
 
 // GetConfig gets a config value from the Config, falling back to the
 // os.Environ. This function can be used with os.Expand.
 func (c *Config) GetConfig(name string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
 	if v, ok := c.Data[name]; ok {
 		return v
 	}
@@ -24,11 +50,99 @@ func (c *Config) GetConfig(name string) string {
 
 // Set sets a value in the Config
 func (c *Config) Set(k, v string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	c.Data[k] = v
 }
 
+// SetFrom sets a value in the Config, recording where it came from.
+func (c *Config) SetFrom(k, v string, src Source) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.History == nil {
+		c.History = make(map[string][]*Source)
+	}
+
+	if src.Secret {
+		c.markSecret(k)
+	}
+
+	src.Value = v
+	c.History[k] = append(c.History[k], &src)
+	c.Data[k] = v
+}
+
+// Copy returns a copy of the values, secrets and structured data of
+// the Config without the history.
+func (c *Config) Copy() *Config {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	o := NewConfig()
+	for k, v := range c.Data {
+		o.Data[k] = v
+	}
+
+	for k := range c.secrets {
+		o.MarkSecret(k)
+	}
+	o.secretPatterns = append(o.secretPatterns, c.secretPatterns...)
+	o.structured = c.structured
+
+	return o
+}
+
+// setBy returns the sources of the values whose last source is the
+// entry at the file and index.
+func (c *Config) setBy(file string, index int) map[string]Source {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	sources := make(map[string]Source)
+	for k, history := range c.History {
+		if len(history) == 0 {
+			continue
+		}
+
+		last := history[len(history)-1]
+		if last.File == file && last.Index == index {
+			sources[k] = *last
+		}
+	}
+	return sources
+}
+
+// Values returns a copy of the values of the Config.
+func (c *Config) Values() map[string]string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	values := make(map[string]string, len(c.Data))
+	for k, v := range c.Data {
+		values[k] = v
+	}
+	return values
+}
+
+// replace replaces the values, history, secrets and structured data
+// with those of o.
+func (c *Config) replace(o *Config) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.Data = o.Data
+	c.History = o.History
+	c.secrets = o.secrets
+	c.secretPatterns = o.secretPatterns
+	c.structured = o.structured
+}
+
 // Get gets a value in the config and is compatible with a map.
 func (c *Config) Get(k string) (string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
 	v, ok := c.Data[k]
 	return v, ok
 }
@@ -36,6 +150,9 @@ func (c *Config) Get(k string) (string, bool) {
 // ToEnv returns the config data as a list of strings that can be used
 // in exec.Cmd
 func (c *Config) ToEnv() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
 	envlist := []string{}
 	for key, val := range c.Data {
 		if key == "" {
@@ -53,29 +170,26 @@ func (c *Config) ToEnv() []string {
 	return envlist
 }
 
+// sortedKeys returns the keys of a map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 var osEnviron = os.Environ
 
 // Environ overlays the config data on top of the existing process
 // environment.
 func (c *Config) Environ() []string {
-	envlist := []string{}
-
-	// filter out values that we have in our config data
-	for _, envvar := range osEnviron() {
-		key := strings.SplitN(envvar, "=", 2)[0]
-		if _, ok := c.Data[key]; !ok {
-			envlist = append(envlist, envvar)
-		}
-	}
-
-	// Then add our config
-	envlist = append(envlist, c.ToEnv()...)
-
-	return envlist
+	return c.environ(nil)
 }
 
 func (c *Config) Diff(o *Config) *Config {
-	diff := &Config{make(map[string]string)}
+	diff := NewConfig()
 
 	compareConfigs(c, o, diff)
 	compareConfigs(o, c, diff)
@@ -88,7 +202,7 @@ func (c *Config) Diff(o *Config) *Config {
 }
 
 func compareConfigs(a, b, diff *Config) {
-	for key, val := range a.Data {
+	for key, val := range a.Values() {
 		otherVal, ok := b.Get(key)
 		if !ok {
 			diff.Set(key, val)
@@ -101,3 +101,58 @@ func TestEnviron(t *testing.T) {
 		}
 	}
 }
+
+func TestExplain(t *testing.T) {
+	e, err := config.NewEnvironmentFromConfig("testdata/explain.yml")
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	sources := e.Config.Explain("FOO")
+	if len(sources) != 3 {
+		t.Fatalf("wrong number of sources: %d", len(sources))
+	}
+
+	expected := []struct {
+		kind, command, value string
+		index                int
+	}{
+		{config.SourceValue, "", "bar", 0},
+		{config.SourceCommand, "`echo baz`", "baz", 1},
+		{config.SourceEnvScript, "cat maps.yml", "bar", 2},
+	}
+
+	for i, ex := range expected {
+		src := sources[i]
+		if src.Kind != ex.kind || src.Command != ex.command || src.Value != ex.value || src.Index != ex.index {
+			t.Errorf("wrong source %d: %#v", i, src)
+		}
+	}
+}
+
+func TestExplainInheritedFromOS(t *testing.T) {
+	varName := "XE_CONFIG_TEST_VAR_EXPLAIN"
+	os.Setenv(varName, "from-os")
+	defer os.Unsetenv(varName)
+
+	c := config.NewConfig()
+	c.SetFrom(varName, "from-config", config.Source{Kind: config.SourceValue})
+
+	sources := c.Explain(varName)
+	if len(sources) != 2 {
+		t.Fatalf("wrong number of sources: %d", len(sources))
+	}
+
+	if sources[0].Kind != config.SourceOS || sources[0].Value != "from-os" {
+		t.Errorf("expected the os environment first: %#v", sources[0])
+	}
+
+	if sources[1].Value != "from-config" {
+		t.Errorf("expected the config value last: %#v", sources[1])
+	}
+}
@@ -0,0 +1,278 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// stepName returns the name of a task or envscript entry.
+func (cfg *XeConfig) stepName() string {
+	switch {
+	case cfg.Task != nil:
+		return cfg.Task.Name
+	case cfg.EnvScript != nil:
+		return cfg.EnvScript.Name
+	}
+	return ""
+}
+
+// dependsOn returns the steps a task or envscript entry depends on.
+// It is nil when the entry doesn't declare any dependencies.
+func (cfg *XeConfig) dependsOn() []string {
+	switch {
+	case cfg.Task != nil:
+		return cfg.Task.DependsOn
+	case cfg.EnvScript != nil:
+		return cfg.EnvScript.DependsOn
+	}
+	return nil
+}
+
+// concurrent reports if the entry can run at the same time as the
+// entries around it.
+func (cfg *XeConfig) concurrent() bool {
+	return cfg.dependsOn() != nil
+}
+
+// runEntries runs the entries in order. Entries next to each other that
+// declare depends_on are run at the same time, each one starting once
+// the steps it depends on are done.
+func (e *Environment) runEntries(cfgs []*XeConfig) error {
+	ran := make(map[string]bool)
+
+	for i := 0; i < len(cfgs); {
+		n := 0
+		for i+n < len(cfgs) && cfgs[i+n].concurrent() {
+			n++
+		}
+
+		if n == 0 {
+			err := e.runEntry(cfgs[i])
+			if err != nil {
+				return err
+			}
+			if name := cfgs[i].stepName(); name != "" {
+				ran[name] = true
+			}
+			i++
+			continue
+		}
+
+		err := e.runGraph(cfgs[i:i+n], ran)
+		if err != nil {
+			return err
+		}
+		i += n
+	}
+
+	return nil
+}
+
+// runEntry runs a single entry, adding its location to any error.
+func (e *Environment) runEntry(cfg *XeConfig) error {
+	err := e.ConfigHandler(cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %s", cfg.Location(), err)
+	}
+	return nil
+}
+
+// stepGraph is the dependencies between a group of entries.
+type stepGraph struct {
+	cfgs []*XeConfig
+
+	// deps are the indexes of the entries each entry depends on.
+	deps [][]int
+}
+
+// newStepGraph finds the dependencies of the entries. Dependencies on
+// steps that already ran are done, while unknown steps and cycles are
+// errors.
+func newStepGraph(cfgs []*XeConfig, ran map[string]bool) (*stepGraph, error) {
+	names := make(map[string]int)
+	for i, cfg := range cfgs {
+		name := cfg.stepName()
+		if name == "" {
+			continue
+		}
+		if _, ok := names[name]; ok {
+			return nil, fmt.Errorf("%s: more than one step is named %s", cfg.Location(), name)
+		}
+		names[name] = i
+	}
+
+	g := &stepGraph{cfgs: cfgs, deps: make([][]int, len(cfgs))}
+	for i, cfg := range cfgs {
+		for _, dep := range cfg.dependsOn() {
+			if j, ok := names[dep]; ok {
+				g.deps[i] = append(g.deps[i], j)
+				continue
+			}
+			if !ran[dep] {
+				return nil, fmt.Errorf("%s: depends on unknown step %s", cfg.Location(), dep)
+			}
+		}
+	}
+
+	if cycle := g.cycle(); cycle != nil {
+		return nil, fmt.Errorf("%s: dependency cycle: %s", cfgs[cycle[0]].Location(), g.describe(cycle))
+	}
+
+	return g, nil
+}
+
+// cycle returns the indexes of a cycle in the graph or nil.
+func (g *stepGraph) cycle() []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(g.cfgs))
+	path := []int{}
+
+	var visit func(i int) []int
+	visit = func(i int) []int {
+		state[i] = visiting
+		path = append(path, i)
+
+		for _, j := range g.deps[i] {
+			switch state[j] {
+			case visiting:
+				for k, p := range path {
+					if p == j {
+						return append(append([]int{}, path[k:]...), j)
+					}
+				}
+			case unvisited:
+				if cycle := visit(j); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+
+	for i := range g.cfgs {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+func (g *stepGraph) describe(steps []int) string {
+	names := make([]string, len(steps))
+	for i, step := range steps {
+		names[i] = g.cfgs[step].stepName()
+	}
+	return strings.Join(names, " -> ")
+}
+
+// order returns the entries so each one comes after its dependencies,
+// otherwise keeping the order of the config.
+func (g *stepGraph) order() []*XeConfig {
+	done := make([]bool, len(g.cfgs))
+	ordered := make([]*XeConfig, 0, len(g.cfgs))
+
+	for len(ordered) < len(g.cfgs) {
+		for i, cfg := range g.cfgs {
+			if done[i] || !g.ready(i, done) {
+				continue
+			}
+			done[i] = true
+			ordered = append(ordered, cfg)
+			break
+		}
+	}
+
+	return ordered
+}
+
+func (g *stepGraph) ready(i int, done []bool) bool {
+	for _, j := range g.deps[i] {
+		if !done[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// runGraph runs a group of entries with dependencies. Each entry
+// starts as soon as its dependencies are done. When planning, the
+// entries are run one at a time in order instead.
+func (e *Environment) runGraph(cfgs []*XeConfig, ran map[string]bool) error {
+	g, err := newStepGraph(cfgs, ran)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		for _, cfg := range cfgs {
+			if name := cfg.stepName(); name != "" {
+				ran[name] = true
+			}
+		}
+	}()
+
+	if e.Planning {
+		for _, cfg := range g.order() {
+			err := e.runEntry(cfg)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	done := make([]chan struct{}, len(cfgs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	errs := make([]error, len(cfgs))
+
+	// failed marks the entries that failed or were skipped because a
+	// dependency failed.
+	failed := make([]bool, len(cfgs))
+
+	var wg sync.WaitGroup
+	for i, cfg := range cfgs {
+		wg.Add(1)
+		go func(i int, cfg *XeConfig) {
+			defer wg.Done()
+			defer close(done[i])
+
+			for _, j := range g.deps[i] {
+				<-done[j]
+				if failed[j] {
+					log.WithFields(log.Fields{
+						"entry":      cfg.Location(),
+						"depends_on": cfgs[j].stepName(),
+					}).Warn("skipping entry, a dependency failed")
+					failed[i] = true
+					return
+				}
+			}
+
+			errs[i] = e.runEntry(cfg)
+			failed[i] = errs[i] != nil
+		}(i, cfg)
+	}
+	wg.Wait()
+
+	// Report the first failure in the order of the config.
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
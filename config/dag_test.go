@@ -0,0 +1,176 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ionrock/xenv/config"
+)
+
+func runPre(t *testing.T, dir string) (*config.Environment, error) {
+	e, err := config.NewEnvironmentFromConfig(filepath.Join(dir, "xe.yml"))
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+	return e, e.Pre()
+}
+
+func TestDependsOnRunsConcurrently(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- task:
+    name: fetch-a
+    cmd: 'sleep 0.5 && echo "A: a" > a.yml'
+    depends_on: []
+- task:
+    name: fetch-b
+    cmd: 'sleep 0.5 && echo "B: b" > b.yml'
+    depends_on: []
+- envscript:
+    name: load
+    cmd: cat a.yml b.yml
+    depends_on: [fetch-a, fetch-b]
+- task:
+    name: after
+    cmd: echo $A$B > after.txt
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("expected the fetches to run at the same time, took %s", elapsed)
+	}
+
+	for k, v := range map[string]string{"A": "a", "B": "b"} {
+		if result, _ := e.Config.Get(k); result != v {
+			t.Errorf("wrong value for %s: %q", k, result)
+		}
+	}
+
+	if result := readFile(t, filepath.Join(dir, "after.txt")); result != "ab\n" {
+		t.Errorf("step after the group didn't see its values: %q", result)
+	}
+}
+
+func TestDependsOnErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      string
+		expected string
+	}{
+		{
+			name: "cycle",
+			cfg: `---
+- task:
+    name: a
+    cmd: "true"
+    depends_on: [b]
+- task:
+    name: b
+    cmd: "true"
+    depends_on: [a]
+`,
+			expected: "dependency cycle: a -> b -> a",
+		},
+		{
+			name: "unknown",
+			cfg: `---
+- task:
+    name: a
+    cmd: "true"
+    depends_on: [nope]
+`,
+			expected: "depends on unknown step nope",
+		},
+		{
+			name: "duplicate",
+			cfg: `---
+- task:
+    name: a
+    cmd: "true"
+    depends_on: []
+- envscript:
+    name: a
+    cmd: echo '{}'
+    depends_on: []
+`,
+			expected: "more than one step is named a",
+		},
+	}
+
+	for _, tc := range tests {
+		dir := writeFiles(t, map[string]string{"xe.yml": tc.cfg})
+		defer os.RemoveAll(dir)
+
+		_, err := runPre(t, dir)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: expected an error with %q, got %v", tc.name, tc.expected, err)
+		}
+	}
+}
+
+func TestDependsOnEarlierStep(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- task:
+    name: setup
+    cmd: echo setup > setup.txt
+- task:
+    name: a
+    cmd: cat setup.txt > a.txt
+    depends_on: [setup]
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "a.txt")); result != "setup\n" {
+		t.Errorf("wrong output: %q", result)
+	}
+}
+
+func TestDependsOnSkipsAfterFailure(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- task:
+    name: fails
+    cmd: exit 1
+    depends_on: []
+- task:
+    name: dependent
+    cmd: touch dependent.txt
+    depends_on: [fails]
+- task:
+    name: independent
+    cmd: touch independent.txt
+    depends_on: []
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := runPre(t, dir)
+	if err == nil {
+		t.Fatal("expected the failed task to be reported")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "dependent.txt")); err == nil {
+		t.Error("expected the dependent task to be skipped")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "independent.txt")); err != nil {
+		t.Error("expected the independent task to run")
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var dotenvKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// ParseDotenv parses the contents of a .env file. Lines may start with
+// "export" and comments start with "#". Single quoted values are used
+// as is. Double quoted values support escapes such as \n and may span
+// lines. Double quoted and unquoted values have ${VAR} references
+// replaced using the earlier values of the file or else the expand
+// function. Nothing is expanded when expand is nil.
+func ParseDotenv(b []byte, expand func(string) string) (map[string]interface{}, error) {
+	env := make(map[string]interface{})
+
+	lookup := func(k string) string {
+		if v, ok := env[k]; ok {
+			return v.(string)
+		}
+		return expand(k)
+	}
+	lines := strings.Split(strings.Replace(string(b), "\r\n", "\n", -1), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		lineno := i + 1
+		line := strings.TrimSpace(lines[i])
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "export ") || strings.HasPrefix(line, "export\t") {
+			line = strings.TrimSpace(line[len("export"):])
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineno)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		if !dotenvKey.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid key %q", lineno, key)
+		}
+
+		value := strings.TrimLeft(parts[1], " \t")
+
+		switch {
+		case strings.HasPrefix(value, "'"), strings.HasPrefix(value, `"`):
+			quote := value[0]
+			value = value[1:]
+
+			// Quoted values may continue on the following lines.
+			for !hasClosingQuote(value, quote) {
+				i++
+				if i == len(lines) {
+					return nil, fmt.Errorf("line %d: missing closing quote", lineno)
+				}
+				value += "\n" + lines[i]
+			}
+
+			end := closingQuote(value, quote)
+			rest := strings.TrimSpace(value[end+1:])
+			if rest != "" && !strings.HasPrefix(rest, "#") {
+				return nil, fmt.Errorf("line %d: unexpected text after quoted value", lineno)
+			}
+			value = value[:end]
+
+			if quote == '"' {
+				// An escaped $ is never expanded.
+				parts := strings.Split(value, `\$`)
+				for j := range parts {
+					parts[j] = dotenvEscapes.Replace(parts[j])
+					if expand != nil {
+						parts[j] = os.Expand(parts[j], lookup)
+					}
+				}
+				value = strings.Join(parts, "$")
+			}
+
+		default:
+			// Unquoted values end at a comment.
+			if idx := strings.Index(value, " #"); idx >= 0 {
+				value = value[:idx]
+			}
+			value = strings.TrimSpace(value)
+
+			if expand != nil {
+				value = os.Expand(value, lookup)
+			}
+		}
+
+		env[key] = value
+	}
+
+	return env, nil
+}
+
+// closingQuote finds the index of the quote ending the value or -1.
+func closingQuote(value string, quote byte) int {
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && quote == '"':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func hasClosingQuote(value string, quote byte) bool {
+	return closingQuote(value, quote) >= 0
+}
+
+var dotenvEscapes = strings.NewReplacer(
+	`\n`, "\n",
+	`\r`, "\r",
+	`\t`, "\t",
+	`\"`, `"`,
+	`\\`, `\`,
+)
@@ -0,0 +1,53 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/ionrock/xenv/config"
+)
+
+func TestParseDotenv(t *testing.T) {
+	b := []byte(`
+# comment
+export FOO=bar
+BAZ = "quoted # not a comment" # a comment
+HELLO='$FOO'
+`)
+
+	env, err := config.ParseDotenv(b, func(string) string { return "expanded" })
+	if err != nil {
+		t.Fatalf("error parsing dotenv: %s", err)
+	}
+
+	expected := map[string]string{
+		"FOO":   "bar",
+		"BAZ":   "quoted # not a comment",
+		"HELLO": "$FOO",
+	}
+
+	if len(env) != len(expected) {
+		t.Errorf("wrong number of values: %#v", env)
+	}
+
+	for k, v := range expected {
+		if env[k] != v {
+			t.Errorf("wrong value for %s: %q != %q", k, env[k], v)
+		}
+	}
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	tests := []string{
+		"NO_EQUALS",
+		"BAD KEY=value",
+		`UNCLOSED="value`,
+		`TRAILING="value" text`,
+	}
+
+	for _, test := range tests {
+		_, err := config.ParseDotenv([]byte(test), nil)
+		if err == nil {
+			t.Errorf("expected an error parsing %q", test)
+		}
+	}
+}
@@ -3,16 +3,19 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
-	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codeskyblue/kexec"
 	"github.com/ionrock/xenv/manager"
+	"github.com/ionrock/xenv/templates"
 	"github.com/ionrock/xenv/util"
 )
 
@@ -51,6 +54,60 @@ type Environment struct {
 
 	DataOnly bool
 	post     []*XeConfig
+
+	// Planning records what each entry would do in Plan instead of
+	// rendering templates, starting services or running tasks.
+	Planning bool
+
+	// NoExec skips running the commands of values, envscripts and
+	// template exec functions while Planning.
+	NoExec bool
+
+	// Plan holds the steps recorded while Planning.
+	Plan []*PlanStep
+
+	// step is the step being recorded while Planning and inPost marks
+	// the steps of Post.
+	step   *PlanStep
+	inPost bool
+
+	// services are the started services by name.
+	services map[string]*Service
+
+	// serviceExits receives an error when a service the main command
+	// exits with has stopped.
+	serviceExits chan error
+
+	// watch is the watch setting and watched are the entries to
+	// watch for changes on their own.
+	watch   *Watch
+	watched []*XeConfig
+
+	// stopSettings is how the main command is stopped.
+	stopSettings *Stop
+
+	// onChange is what happens when the config data changes and tasks
+	// are the task entries by name.
+	onChange *OnChange
+	tasks    map[string]*XeConfig
+
+	// shell runs the command lines of steps without their own.
+	shell Shell
+
+	// inherit is which values of the environment of xenv are passed
+	// on.
+	inherit *Inherit
+
+	// previous is the config of the running environment while the
+	// data is rebuilt, so the values registered by tasks are kept.
+	previous *Config
+
+	// mu guards the Config while watchers look for changes.
+	mu sync.RWMutex
+
+	// stateLock guards the tasks and watched entries while entries
+	// run at the same time.
+	stateLock sync.Mutex
 }
 
 // NewEnvironment creates a new *Environment rooted at the provided
@@ -59,7 +116,11 @@ func NewEnvironment() *Environment {
 	return &Environment{
 		Services: manager.New(),
 		Tasks:    make(map[string]*exec.Cmd),
-		Config:   &Config{make(map[string]string)},
+		Config:   NewConfig(),
+
+		services:     make(map[string]*Service),
+		serviceExits: make(chan error, 1),
+		tasks:        make(map[string]*XeConfig),
 	}
 }
 
@@ -83,13 +144,12 @@ func (e *Environment) Pre() error {
 		return err
 	}
 
-	for _, cfg := range cfgs {
-		if err := e.ConfigHandler(cfg); err != nil {
-			log.WithError(err).WithFields(log.Fields{
-				"config": cfg,
-			}).Warn("error running config")
-			return err
-		}
+	e.Services.NameWidth = findLongestServiceName(cfgs)
+
+	err = e.runEntries(cfgs)
+	if err != nil {
+		log.WithError(err).Warn("error running config")
+		return err
 	}
 
 	return nil
@@ -103,22 +163,23 @@ func (e *Environment) Post() error {
 	}
 
 	log.Info("Running Post Events")
-	for _, cfg := range e.post {
-		// We don't worry about using a data handler here.
-		if err := e.ConfigHandler(cfg); err != nil {
-			return err
-		}
-	}
+	e.inPost = true
+	defer func() { e.inPost = false }()
 
-	return nil
+	// We don't worry about using a data handler here.
+	return e.runEntries(e.post)
 }
 
 // SetEnvFromEnvvars sets environment values from a list of key value
 // pairs ([]map[string]string).
 func (e *Environment) SetEnvFromEnvvars(envvars []map[string]string) error {
+	return e.setEnvFromEnvvars(envvars, e.ConfigDir, Source{}, RunOptions{})
+}
+
+func (e *Environment) setEnvFromEnvvars(envvars []map[string]string, dir string, src Source, opts RunOptions) error {
 	for _, m := range envvars {
-		for k, v := range m {
-			err := e.SetEnv(k, v)
+		for _, k := range sortedKeys(m) {
+			err := e.setEnv(k, m[k], dir, src, opts)
 			if err != nil {
 				return err
 			}
@@ -130,8 +191,29 @@ func (e *Environment) SetEnvFromEnvvars(envvars []map[string]string) error {
 
 // SetEnv sets an environment value.
 func (e *Environment) SetEnv(k, v string) error {
-	v = os.Expand(v, e.Config.GetConfig)
-	val, err := CompileValue(v, e.ConfigDir, e.Config.ToEnv())
+	return e.setEnv(k, v, e.ConfigDir, Source{}, RunOptions{})
+}
+
+// setEnv sets an environment value, running any commands in dir with
+// the opts. The src records where the value came from.
+func (e *Environment) setEnv(k, v, dir string, src Source, opts RunOptions) error {
+	v = os.Expand(v, e.lookup)
+
+	if src.Kind == "" {
+		src.Kind = SourceValue
+		if isCommand(v) {
+			src.Kind = SourceCommand
+			src.Command = v
+		}
+	}
+	source := src.Describe()
+
+	val, err := v, error(nil)
+	if e.NoExec && isCommand(v) {
+		source = "command not run"
+	} else {
+		val, err = compileValue(v, dir, e.environ(), e.shell, opts)
+	}
 
 	if err != nil {
 		log.WithFields(log.Fields{
@@ -140,34 +222,105 @@ func (e *Environment) SetEnv(k, v string) error {
 		return err
 	}
 
+	e.set(k, val, src, source)
+	return nil
+}
+
+// set sets a computed value, recording it in the plan with the
+// description of its source.
+func (e *Environment) set(k, val string, src Source, source string) {
+	e.Config.SetFrom(k, val, src)
+
 	log.WithFields(log.Fields{
-		"key": k, "value": v,
+		"key": k, "value": e.Config.Redact(k, val),
 	}).Debug("setting value")
 
-	e.Config.Set(k, val)
+	if e.step != nil {
+		e.step.Keys = append(e.step.Keys, PlanKey{Key: k, Value: e.Config.Redact(k, val), Source: source})
+	}
+}
+
+// setEnvFromFile reads a dotenv, YAML, JSON or TOML file, flattens it
+// and adds it to the environment without running any commands.
+func (e *Environment) setEnvFromFile(ef *EnvFile, dir string, src Source) error {
+	fe := &FlatEnv{
+		Path:    ef.path(dir),
+		Format:  ef.Format,
+		Expand:  e.lookup,
+		Env:     make(map[string]string),
+		Options: ef.FlattenOptions,
+	}
+
+	f, err := fe.Decode()
+	if err != nil {
+		return err
+	}
+
+	err = fe.Flatten(f)
+	if err != nil {
+		return err
+	}
+
+	// Dotenv files are already expanded.
+	if fe.FileFormat() != FormatDotenv {
+		f = expandData(f, e.lookup)
+	}
+	e.Config.SetData(dataPath(ef.FlattenOptions), f)
+
+	for _, k := range sortedKeys(fe.Env) {
+		val := fe.Env[k]
+
+		// Dotenv files expand values based on the quoting.
+		if fe.FileFormat() != FormatDotenv {
+			val = os.Expand(val, e.lookup)
+		}
+
+		e.set(k, val, src, src.Describe())
+	}
+
 	return nil
 }
 
 // SetEnvFromScript will run a script that outputs YAML or JSON,
 // flatten the output and add it to the environment's configuration.
 func (e *Environment) SetEnvFromScript(cmd, dir string) error {
+	return e.setEnvFromScript(&EnvScript{Cmd: Command{Line: cmd}}, dir, Source{Kind: SourceEnvScript, Command: cmd}, RunOptions{})
+}
+
+// setEnvFromScript runs the envscript with its own RunOptions, or the
+// opts when it sets none. The opts are used for any commands in the
+// values it outputs.
+func (e *Environment) setEnvFromScript(es *EnvScript, dir string, src Source, opts RunOptions) error {
 	s := Script{
-		Cmd: cmd,
-		Dir: dir,
-		Env: e.Config.ToEnv(),
+		Cmd:        es.Cmd.String(),
+		Args:       es.Cmd.expand(e.lookup).Args(e.shellFor(es.Shell)),
+		Dir:        dir,
+		Env:        e.environ(),
+		Options:    es.FlattenOptions,
+		RunOptions: es.RunOptions.or(opts),
+	}
+
+	f, err := s.Decode()
+	if err != nil {
+		return err
 	}
 
-	env, err := s.Load()
+	env, err := s.flatten(f)
 	if err != nil {
 		return err
 	}
 
-	for k, v := range env {
+	e.Config.SetData(dataPath(es.FlattenOptions), expandData(f, e.lookup))
+
+	for _, k := range sortedKeys(env) {
 		// We expand the value if it has any vars defined. This will
 		// also remove expansions that don't exist leaving things with an
 		// empty string.
-		val := os.Expand(v, e.Config.GetConfig)
-		e.SetEnv(k, val)
+		val := os.Expand(env[k], e.lookup)
+		err := e.setEnv(k, val, dir, src, opts)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -184,43 +337,325 @@ func (e *Environment) RunTask(name, command, dir string) error {
 		Name: name,
 		Cmd:  command,
 		Dir:  dir,
-		Env:  e.Config.ToEnv(),
+		Env:  e.environ(),
 	}
 
 	return t.Run()
 }
 
+// runTaskEntry runs the task of an entry with its RunOptions, or those
+// of the entry when it sets none, registering its output when it is
+// set. Nothing is registered for a task that failed with its errors
+// ignored. The task runs in dir unless it has its own.
+func (e *Environment) runTaskEntry(cfg *XeConfig, dir string) error {
+	task := cfg.Task
+
+	taskDir := task.Dir
+	if taskDir == "" {
+		taskDir = dir
+	}
+
+	t := &Task{
+		Name:       task.Name,
+		Cmd:        task.Cmd.String(),
+		Args:       task.Cmd.expand(e.lookup).Args(e.shellFor(task.Shell)),
+		Dir:        taskDir,
+		Env:        e.taskEnv(task),
+		RunOptions: task.RunOptions.or(cfg.RunOptions),
+	}
+
+	if task.User != "" || task.Group != "" {
+		uid, gid, err := util.LookupIDs(task.User, task.Group)
+		if err != nil {
+			return err
+		}
+		t.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	}
+
+	if task.Register == "" {
+		return t.Run()
+	}
+
+	// The output is logged once it is registered so secret values are
+	// redacted.
+	var stdout []string
+	t.Output = new(bytes.Buffer)
+	t.StdoutHandler = func(line string) string {
+		stdout = append(stdout, line)
+		return line
+	}
+
+	err := t.Run()
+	if err != nil || t.Failed {
+		e.logUnregistered(cfg, t, stdout)
+		return err
+	}
+
+	err = e.register(cfg, t.Output.String())
+	if err != nil {
+		return err
+	}
+
+	for _, line := range stdout {
+		t.log().Info(line)
+	}
+	return nil
+}
+
+// taskEnv returns the environment of a task. The values of the task
+// are expanded using the config and added on top of it, or used on
+// their own when the task doesn't inherit the config.
+func (e *Environment) taskEnv(task *XeTask) []string {
+	env := []string{}
+
+	if task.InheritEnv == nil || *task.InheritEnv {
+		for _, kv := range e.environ() {
+			if _, ok := task.Env[strings.SplitN(kv, "=", 2)[0]]; !ok {
+				env = append(env, kv)
+			}
+		}
+	}
+
+	for _, k := range sortedKeys(task.Env) {
+		env = append(env, fmt.Sprintf("%s=%s", k, os.Expand(task.Env[k], e.lookup)))
+	}
+
+	return env
+}
+
+// StartService starts a long running process alongside the main
+// command. The output is prefixed by the name of the service and the
+// process is restarted according to the service's restart policy.
+func (e *Environment) StartService(svc *Service) error {
+	switch svc.Restart {
+	case "", manager.RestartAlways, manager.RestartOnFailure, manager.RestartNever:
+	default:
+		return fmt.Errorf("unknown restart policy for service %s: %s", svc.Name, svc.Restart)
+	}
+
+	dir := svc.Dir
+	if dir == "" {
+		dir = e.ConfigDir
+	}
+
+	name := svc.Name
+	if name == "" {
+		name = svc.Cmd.String()
+	}
+
+	log.WithFields(log.Fields{
+		"name": name,
+		"cmd":  svc.Cmd.String(),
+	}).Info("Starting service")
+
+	args := svc.Cmd.expand(e.lookup).Args(e.shellFor(svc.Shell))
+	err := e.Services.StartArgs(name, args, dir, e.environ())
+	if err != nil {
+		return err
+	}
+	e.services[name] = svc
+
+	exited := e.Services.Supervise(name, svc.RestartPolicy())
+	go func() {
+		err := <-exited
+		log.WithField("name", name).Info("Service exited")
+
+		if !svc.MainExitsWith {
+			return
+		}
+
+		if err == nil {
+			err = fmt.Errorf("service %s exited", name)
+		} else {
+			err = fmt.Errorf("service %s exited: %s", name, err)
+		}
+
+		// Only the first exit matters to stop the main command.
+		select {
+		case e.serviceExits <- err:
+		default:
+		}
+	}()
+
+	return nil
+}
+
 // ConfigHandler calls the respective handler actionss based on the
 // passed in XeConfig. It is assumed the XeConfig will only have 1 field
 // in its struct filled in.
 func (e *Environment) ConfigHandler(cfg *XeConfig) error {
+	if e.Planning {
+		e.step = &PlanStep{Location: cfg.Location(), Post: e.inPost}
+		e.Plan = append(e.Plan, e.step)
+		defer func() { e.step = nil }()
+	}
+
+	for _, when := range cfg.conditions() {
+		ok, err := templates.Condition(when, e.Config.Values())
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			log.WithFields(log.Fields{
+				"entry": cfg.Location(),
+				"when":  when,
+			}).Debug("skipping entry")
+
+			if e.step != nil {
+				e.step.Description = fmt.Sprintf("skip, %s is false", when)
+			}
+			return nil
+		}
+	}
+
+	dir := e.entryDir(cfg)
+
 	switch {
 	case cfg.Env != nil:
-		err := e.SetEnvFromEnvvars(cfg.Env)
+		e.describe("set env")
+		err := e.setEnvFromEnvvars(cfg.Env, dir, cfg.source("", ""), cfg.RunOptions)
+		if err != nil {
+			return err
+		}
+
+	case cfg.EnvScript != nil && e.NoExec:
+		e.describe("run envscript %s (not run)", cfg.EnvScript.Cmd)
+
+	case cfg.EnvScript != nil:
+		e.describe("set env from envscript %s", cfg.EnvScript.Cmd)
+		err := e.setEnvFromScript(cfg.EnvScript, dir, cfg.source(SourceEnvScript, cfg.EnvScript.Cmd.String()), cfg.RunOptions)
+		if err != nil {
+			return err
+		}
+
+	case cfg.EnvFile != nil:
+		e.describe("set env from file %s", cfg.EnvFile.Path)
+		err := e.setEnvFromFile(cfg.EnvFile, dir, cfg.source(SourceEnvFile, cfg.EnvFile.Path))
+		if err != nil {
+			return err
+		}
+
+	case cfg.Template != nil && e.Planning:
+		err := checkTemplate(cfg.Template)
 		if err != nil {
 			return err
 		}
 
-	case cfg.EnvScript != "":
-		err := e.SetEnvFromScript(cfg.EnvScript, e.ConfigDir)
+		e.setTemplateData(cfg.Template)
+		err = e.planTemplate(cfg.Template, dir)
 		if err != nil {
 			return err
 		}
 
 	case cfg.Template != nil && !e.DataOnly:
-		cfg.Template.Env = e.Config.Data
-		err := cfg.Template.Execute(e.ConfigDir)
+		err := checkTemplate(cfg.Template)
 		if err != nil {
 			return err
 		}
 
-	case cfg.Task != nil && !e.DataOnly:
-		err := e.RunTask(cfg.Task.Name, cfg.Task.Cmd, cfg.Task.Dir)
+		e.setTemplateData(cfg.Template)
+		changed, err := cfg.Template.Execute(dir)
 		if err != nil {
 			return err
 		}
 
+		log.WithFields(log.Fields{
+			"target":  cfg.Template.Destination(),
+			"changed": changed,
+		}).Debug("rendered template")
+
+	case cfg.Service != nil && e.Planning:
+		e.describe("start service %s: %s", cfg.Service.Name, cfg.Service.Cmd)
+
+	case cfg.Service != nil && !e.DataOnly:
+		svc := *cfg.Service
+		if svc.Dir == "" {
+			svc.Dir = dir
+		}
+		err := e.StartService(&svc)
+		if err != nil {
+			return err
+		}
+
+	case cfg.Task != nil && e.Planning:
+		if cfg.Task.Register != "" {
+			e.describe("run task %s: %s, register %s", cfg.Task.Name, cfg.Task.Cmd, cfg.Task.Register)
+		} else {
+			e.describe("run task %s: %s", cfg.Task.Name, cfg.Task.Cmd)
+		}
+
+		err := cfg.Task.checkParse()
+		if err != nil {
+			return err
+		}
+
+	case cfg.Task != nil:
+		err := cfg.Task.checkParse()
+		if err != nil {
+			return err
+		}
+
+		if cfg.Task.Name != "" {
+			e.stateLock.Lock()
+			e.tasks[cfg.Task.Name] = cfg
+			e.stateLock.Unlock()
+		}
+
+		if e.DataOnly {
+			e.keepRegistered(cfg)
+			break
+		}
+
+		err = e.runTaskEntry(cfg, dir)
+		if err != nil {
+			return err
+		}
+
+	case cfg.Secrets != nil:
+		e.describe("mark keys matching %s as secret", strings.Join(cfg.Secrets, ", "))
+		for _, pattern := range cfg.Secrets {
+			err := e.Config.AddSecretPattern(pattern)
+			if err != nil {
+				return err
+			}
+		}
+
+	case cfg.Shell != nil:
+		e.describe("run commands with %s", cfg.Shell)
+		e.shell = cfg.Shell
+
+	case cfg.Inherit != nil:
+		e.describe("inherit %s of the environment", cfg.Inherit)
+		err := cfg.Inherit.check()
+		if err != nil {
+			return err
+		}
+		e.inherit = cfg.Inherit
+
+	case cfg.Watch != nil:
+		e.describe("watch for changes")
+		e.watch = cfg.Watch
+
+	case cfg.Stop != nil:
+		e.describe("stop the command with %s", cfg.Stop.signal())
+		err := cfg.Stop.check()
+		if err != nil {
+			return err
+		}
+		e.stopSettings = cfg.Stop
+
+	case cfg.OnChange != nil:
+		e.describe("on change: %s", cfg.OnChange)
+		err := cfg.OnChange.check()
+		if err != nil {
+			return err
+		}
+		e.onChange = cfg.OnChange
+
 	case cfg.Post != nil:
+		e.describe("add %d post entries", len(cfg.Post))
+
 		if e.post == nil {
 			e.post = make([]*XeConfig, 0)
 		}
@@ -230,18 +665,93 @@ func (e *Environment) ConfigHandler(cfg *XeConfig) error {
 		}
 	}
 
+	if !e.DataOnly && !e.Planning && !e.inPost &&
+		(cfg.Refresh > 0 || cfg.EnvFile != nil || cfg.Template != nil) {
+		e.stateLock.Lock()
+		e.watched = append(e.watched, cfg)
+		e.stateLock.Unlock()
+	}
+
 	return nil
 }
 
+// environ returns the environment for commands, the inherited values
+// with the config on top.
+func (e *Environment) environ() []string {
+	return e.Config.environ(e.inherit)
+}
+
+// lookup returns a value from the config, falling back to the
+// inherited environment. It can be used with os.Expand.
+func (e *Environment) lookup(name string) string {
+	if v, ok := e.Config.Get(name); ok {
+		return v
+	}
+
+	if e.inherit.inherits(name) {
+		return os.Getenv(name)
+	}
+	return ""
+}
+
+// setTemplateData sets the environment and the structured data of the
+// config as the data of a template, with the shell and NoExec for its
+// commands.
+func (e *Environment) setTemplateData(tmpl *templates.Renderer) {
+	tmpl.Env = e.templateEnv()
+	tmpl.Data = e.Config.StructuredData()
+	tmpl.Shell = e.shell
+	tmpl.NoExec = e.NoExec
+}
+
+// templateEnv returns the environment as the data for templates.
+func (e *Environment) templateEnv() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range e.environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		env[parts[0]] = parts[1]
+	}
+	return env
+}
+
+// entryDir returns the directory paths in the entry are relative to.
+// Entries from included files are relative to the included file.
+func (e *Environment) entryDir(cfg *XeConfig) string {
+	if dir := cfg.dir(); dir != "" {
+		return dir
+	}
+	return e.ConfigDir
+}
+
+// describe sets the description of the step being planned.
+func (e *Environment) describe(format string, args ...interface{}) {
+	if e.step != nil {
+		e.step.Description = fmt.Sprintf(format, args...)
+	}
+}
+
 // StopServices stops the services managed by the process manager.
 func (e *Environment) StopServices() error {
-	for name := range e.Services.Processes {
-		err := e.Services.Stop(name)
+	for _, name := range e.Services.Names() {
+		err := e.stopService(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stopMainServices stops the services that exit with the main
+// command, leaving the rest running for the post steps.
+func (e *Environment) stopMainServices() error {
+	for _, name := range e.Services.Names() {
+		if svc, ok := e.services[name]; ok && !svc.exitsWithMain() {
+			continue
+		}
+
+		err := e.stopService(name)
 		if err != nil {
-			log.WithFields(log.Fields{
-				"service_name": name,
-				"error":        err,
-			}).Error("problem stopping service")
 			return err
 		}
 	}
@@ -249,9 +759,21 @@ func (e *Environment) StopServices() error {
 	return nil
 }
 
+func (e *Environment) stopService(name string) error {
+	err := e.Services.Stop(name)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"service_name": name,
+			"error":        err,
+		}).Error("problem stopping service")
+	}
+	return err
+}
+
+// Load reads the config file along with any included files.
 func (e *Environment) Load() ([]*XeConfig, error) {
 	log.Debugf("loading %s", e.ConfigFile)
-	cfgs, err := NewXeConfig(e.ConfigFile)
+	cfgs, err := LoadXeConfig(e.ConfigFile)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"config_file": e.ConfigFile,
@@ -262,51 +784,55 @@ func (e *Environment) Load() ([]*XeConfig, error) {
 	return cfgs, nil
 }
 
-func (e *Environment) watchSignals(done chan error, cmd *kexec.KCommand) {
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		sig := <-sigs
-		err := cmd.Terminate(sig)
-		if err != nil {
-			log.WithError(err).Warn("error sending signal")
-		}
-		done <- err
-	}()
-}
+// startCommand starts the main command with the environment. The
+// result of the command is sent on the returned channel.
+func (e *Environment) startCommand(parts []string) (*kexec.KCommand, chan error) {
+	// replace any replacements
+	expanded := make([]string, len(parts))
+	for i := range parts {
+		expanded[i] = os.Expand(parts[i], e.lookup)
+	}
+	parts = expanded
 
-func (e *Environment) watchConfig(cadence *time.Ticker, events chan struct{}) {
-	go func() {
-		for range cadence.C {
-			ne, err := NewEnvironmentFromConfig(e.ConfigFile)
-			if err != nil {
-				log.WithError(err).Warn("error rebuilding config data")
-				continue
-			}
+	log.Infof("Running command: %s", strings.Join(parts, " "))
 
-			ne.DataOnly = true
-			err = ne.Pre()
-			if err != nil {
-				log.WithError(err).Warn("error rebuilding config data")
-				continue
-			}
+	cmd := kexec.Command(parts[0])
+	if len(parts) > 1 {
+		cmd.Args = append(cmd.Args, parts[1:]...)
+	}
+	cmd.Env = e.environ()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 
-			// compare the envs
-			diff := e.Config.Diff(ne.Config)
-			if diff != nil {
-				fields := log.Fields{}
-				for k, v := range diff.Data {
-					fields[k] = v
-				}
-				log.WithFields(fields).Debug("env diff")
-				events <- restartEvent{}
-			}
-		}
+	done := make(chan error, 1)
+	err := cmd.Start()
+	if err != nil {
+		done <- err
+		return cmd, done
+	}
+
+	go func() {
+		done <- cmd.Wait()
 	}()
 
+	return cmd, done
 }
 
-func (e *Environment) wait(cmd *kexec.KCommand, done chan error, events chan struct{}) error {
+// wait waits for the main command to exit, handling signals, changes
+// to the config and services the command exits with.
+func (e *Environment) wait(parts []string, cmd *kexec.KCommand, done chan error) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	for _, sig := range forwardSignals {
+		signal.Notify(sigs, sig)
+	}
+	defer signal.Stop(sigs)
+
+	events := make(chan struct{})
+	stopWatching := make(chan struct{})
+	e.startWatchers(events, stopWatching)
+	defer close(stopWatching)
+
 	for {
 		select {
 		case err := <-done:
@@ -314,74 +840,75 @@ func (e *Environment) wait(cmd *kexec.KCommand, done chan error, events chan str
 				log.WithError(err).Warn("process exit error")
 			}
 			return err
-		case <-events:
-			log.Info("Configuration data changed. Exiting...")
 
-			err := cmd.Terminate(syscall.SIGINT)
+		case sig := <-sigs:
+			if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+				return e.stop(cmd, done, sig.(syscall.Signal))
+			}
+
+			log.WithField("signal", sig).Info("Forwarding signal")
+			err := signalGroup(cmd, sig.(syscall.Signal))
+			if err != nil {
+				log.WithError(err).Warn("error sending signal")
+			}
+
+		case <-events:
+			action, err := e.reload(cmd)
 			if err != nil {
-				log.WithError(err).Warn("error stopping process")
-				if cmd.ProcessState == nil {
-					err = cmd.Terminate(syscall.SIGTERM)
-					if err != nil {
-						log.WithError(err).Warn("error killing process")
-					}
-				}
+				log.WithError(err).Warn("error reloading config")
 			}
+
+			switch action {
+			case reloadExit:
+				log.Info("Configuration data changed. Exiting...")
+				return e.stop(cmd, done, e.stopSettings.signal())
+
+			case reloadRestart:
+				log.Info("Configuration data changed. Restarting...")
+				e.stop(cmd, done, e.stopSettings.signal())
+				cmd, done = e.startCommand(parts)
+			}
+
+		case err := <-e.serviceExits:
+			log.WithError(err).Warn("Service exited. Exiting...")
+			e.stop(cmd, done, e.stopSettings.signal())
 			return err
 		}
 	}
-
-	return nil
 }
 
 // Main runs the configuration items, the main process and any post processes.
 func (e *Environment) Main(parts []string) (err error) {
 	err = e.Pre()
 	if err != nil {
+		e.StopServices()
 		return err
 	}
 
 	if len(parts) == 0 {
-		return nil
-	}
-
-	// replace any replacements
-	for i := range parts {
-		parts[i] = os.Expand(parts[i], e.Config.GetConfig)
+		return e.StopServices()
 	}
 
-	log.Infof("Running command: %s", strings.Join(parts, " "))
+	cmd, done := e.startCommand(parts)
+	err = e.wait(parts, cmd, done)
 
-	cmd := kexec.Command(parts[0])
-	if len(parts) > 1 {
-		cmd.Args = append(cmd.Args, parts[1:]...)
+	stopErr := e.stopMainServices()
+	if stopErr != nil {
+		log.WithError(stopErr).Warn("Error stopping services")
 	}
-	cmd.Env = e.Config.ToEnv()
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	// Start our process and listen for signals
-	done := make(chan error)
-	e.watchSignals(done, cmd)
-
-	go func() {
-		done <- cmd.Run()
-	}()
-
-	events := make(chan struct{})
-	cadence := time.NewTicker(10 * time.Second)
-	defer cadence.Stop()
-
-	e.watchConfig(cadence, events)
-
-	err = e.wait(cmd, done, events)
 
+	// Watchers may still be finishing a check of the config.
+	e.mu.Lock()
 	postErr := e.Post()
+	e.mu.Unlock()
 	if postErr != nil {
 		log.WithError(postErr).Warn("Error running post")
 	}
 
+	stopErr = e.StopServices()
+	if stopErr != nil {
+		log.WithError(stopErr).Warn("Error stopping services")
+	}
+
 	return err
 }
-
-type restartEvent struct{}
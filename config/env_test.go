@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ionrock/xenv/config"
 )
@@ -105,3 +106,140 @@ func TestSetEnvFromScriptExpandsVars(t *testing.T) {
 		t.Errorf("error setting value from existing env: %s", result)
 	}
 }
+
+func TestServiceStartedAndStopped(t *testing.T) {
+	e := config.NewEnvironment()
+
+	cfg := &config.XeConfig{
+		Service: &config.Service{Name: "sleeper", Cmd: config.Command{Line: "sleep 10"}},
+	}
+
+	err := e.ConfigHandler(cfg)
+	if err != nil {
+		t.Fatalf("error starting service: %s", err)
+	}
+
+	if _, ok := e.Services.Processes["sleeper"]; !ok {
+		t.Fatalf("service not started: %#v", e.Services.Processes)
+	}
+
+	err = e.StopServices()
+	if err != nil {
+		t.Errorf("error stopping service: %s", err)
+	}
+}
+
+func TestServiceSkippedForDataOnly(t *testing.T) {
+	e := config.NewEnvironment()
+	e.DataOnly = true
+
+	cfg := &config.XeConfig{
+		Service: &config.Service{Name: "sleeper", Cmd: config.Command{Line: "sleep 10"}},
+	}
+
+	err := e.ConfigHandler(cfg)
+	if err != nil {
+		t.Fatalf("error handling service: %s", err)
+	}
+
+	if len(e.Services.Processes) != 0 {
+		t.Errorf("service started with DataOnly: %#v", e.Services.Processes)
+	}
+}
+
+func TestMainExitsWithService(t *testing.T) {
+	e, err := config.NewEnvironmentFromConfig("testdata/main_exits_with.yml")
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- e.Main([]string{"sleep", "10"})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected an error when the service exited")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("main command didn't exit with the service")
+	}
+}
+
+func TestWhenSkipsEntries(t *testing.T) {
+	e, err := config.NewEnvironmentFromConfig("testdata/when.yml")
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	if result, _ := e.Config.Get("DB"); result != "prod-db" {
+		t.Errorf("wrong value for DB: %q", result)
+	}
+}
+
+func TestSetEnvFromFiles(t *testing.T) {
+	e, err := config.NewEnvironmentFromConfig("testdata/envfile/envfile.yml")
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	expected := map[string]string{
+		"NAME":           "world",
+		"PLAIN":          "hello world",
+		"SINGLE":         "hello ${NAME}",
+		"DOUBLE":         "hello\tworld $NAME",
+		"MULTI":          "one\ntwo",
+		"EMPTY":          "",
+		"APP_name":       "app",
+		"APP_port":       "8080",
+		"APP_db_host":    "db.example.com",
+		"APP_servers_ip": "10.0.0.1",
+		"JSON_FOO":       "bar",
+	}
+
+	for k, v := range expected {
+		result, ok := e.Config.Get(k)
+		if !ok || result != v {
+			t.Errorf("wrong value for %s: %q != %q", k, result, v)
+		}
+	}
+}
+
+func TestFlattenOptionsInConfig(t *testing.T) {
+	e, err := config.NewEnvironmentFromConfig("testdata/flatten.yml")
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	expected := map[string]string{
+		"script_FOO_0": "one",
+		"script_FOO_2": "three",
+		"NAME":         "app",
+		"DB__HOST":     "db.example.com",
+		"SERVERS__IP":  "10.0.0.1",
+	}
+
+	for k, v := range expected {
+		result, ok := e.Config.Get(k)
+		if !ok || result != v {
+			t.Errorf("wrong value for %s: %q != %q", k, result, v)
+		}
+	}
+}
@@ -1,30 +1,111 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/ghodss/yaml"
 )
 
+// Formats of files a FlatEnv can decode.
+const (
+	FormatDotenv = "dotenv"
+	FormatYAML   = "yaml"
+	FormatJSON   = "json"
+	FormatTOML   = "toml"
+)
+
+// Ways a FlatEnv can store lists.
+const (
+	// ListSpace joins the values with a space.
+	ListSpace = "space"
+	// ListComma joins the values with a comma.
+	ListComma = "comma"
+	// ListJSON stores the list as JSON.
+	ListJSON = "json"
+	// ListIndex adds a key for each value using its index, such as
+	// FOO_0 and FOO_1.
+	ListIndex = "index"
+)
+
+// FlattenOptions control how nested data is turned into keys.
+type FlattenOptions struct {
+	// Separator joins the levels of a key. The default is "_".
+	Separator string `json:"separator"`
+
+	// Upper upper cases the keys.
+	Upper bool `json:"upper"`
+
+	// Prefix is added to the keys.
+	Prefix string `json:"prefix"`
+
+	// Lists is how lists are stored: space, comma, json or index. The
+	// default is space.
+	Lists string `json:"lists"`
+}
+
 // FlatEnv provides a flattend list of key/values based on a hierarchy
 // that might be found in a YAML or JSON file.
 type FlatEnv struct {
 	// Path to the YAML / JSON file.
 	Path string
 
+	// Format of the file. When it is empty the format is found using
+	// the file extension, defaulting to YAML.
+	Format string
+
+	// Expand looks up ${VAR} references in dotenv values.
+	Expand func(string) string
+
+	// Options control how the keys and lists are flattened.
+	Options FlattenOptions
+
 	// Env maintains the map[string]string of the flattened data.
 	Env map[string]string
 }
 
+// FileFormat returns the format of the file, using the Format when it
+// is set or else the file extension.
+func (env *FlatEnv) FileFormat() string {
+	if env.Format != "" {
+		return env.Format
+	}
+
+	base := filepath.Base(env.Path)
+	switch {
+	case base == ".env", strings.HasPrefix(base, ".env."), filepath.Ext(base) == ".env":
+		return FormatDotenv
+	case filepath.Ext(base) == ".json":
+		return FormatJSON
+	case filepath.Ext(base) == ".toml":
+		return FormatTOML
+	}
+
+	return FormatYAML
+}
+
 func (env *FlatEnv) key(parts []string) (string, error) {
 	if len(parts) == 0 {
 		return "", errors.New("no prefix for key")
 	}
-	return strings.Join(parts, "_"), nil
+
+	sep := env.Options.Separator
+	if sep == "" {
+		sep = "_"
+	}
+
+	key := strings.Join(parts, sep)
+	if env.Options.Upper {
+		key = strings.ToUpper(key)
+	}
+	return key, nil
 }
 
 func (env *FlatEnv) addString(prefix []string, value string) error {
@@ -34,7 +115,11 @@ func (env *FlatEnv) addString(prefix []string, value string) error {
 	}
 
 	if _, ok := env.Env[key]; ok {
-		value = fmt.Sprintf("%s %s", env.Env[key], value)
+		sep := " "
+		if env.Options.Lists == ListComma {
+			sep = ","
+		}
+		value = env.Env[key] + sep + value
 	}
 	env.Env[key] = value
 	return nil
@@ -59,11 +144,27 @@ func (env *FlatEnv) Load(v interface{}, prefix []string) error {
 	}
 
 	iterSlice := func(x []interface{}, prefix []string) {
-		for _, v := range x {
+		for i, v := range x {
+			if env.Options.Lists == ListIndex {
+				env.Load(v, append(prefix, strconv.Itoa(i)))
+				continue
+			}
 			env.Load(v, prefix)
 		}
 	}
 
+	// Lists stored as JSON keep their values as they are.
+	switch v.(type) {
+	case []interface{}, []map[string]interface{}:
+		if env.Options.Lists == ListJSON {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			return env.addString(prefix, string(b))
+		}
+	}
+
 	switch vv := v.(type) {
 	case string:
 		if err := env.addString(prefix, v.(string)); err != nil {
@@ -77,10 +178,26 @@ func (env *FlatEnv) Load(v interface{}, prefix []string) error {
 		if err := env.addFloat64(prefix, v.(float64)); err != nil {
 			return err
 		}
+	case int64:
+		if err := env.addString(prefix, strconv.FormatInt(vv, 10)); err != nil {
+			return err
+		}
+	case time.Time:
+		if err := env.addString(prefix, vv.Format(time.RFC3339)); err != nil {
+			return err
+		}
 	case map[string]interface{}:
 		iterMap(vv, prefix)
 	case []interface{}:
 		iterSlice(vv, prefix)
+	case []map[string]interface{}:
+		for i, m := range vv {
+			if env.Options.Lists == ListIndex {
+				iterMap(m, append(prefix, strconv.Itoa(i)))
+				continue
+			}
+			iterMap(m, prefix)
+		}
 	default:
 		return fmt.Errorf("Unknown type: %#v", vv)
 	}
@@ -88,6 +205,23 @@ func (env *FlatEnv) Load(v interface{}, prefix []string) error {
 	return nil
 }
 
+// Flatten checks the options and loads v into the Env, starting the
+// keys with the prefix of the options.
+func (env *FlatEnv) Flatten(v interface{}) error {
+	switch env.Options.Lists {
+	case "", ListSpace, ListComma, ListJSON, ListIndex:
+	default:
+		return fmt.Errorf("unknown lists %q, expected one of: space, comma, json, index", env.Options.Lists)
+	}
+
+	prefix := []string{}
+	if env.Options.Prefix != "" {
+		prefix = append(prefix, env.Options.Prefix)
+	}
+
+	return env.Load(v, prefix)
+}
+
 // Decode reads the FlatEnv's path to create an interface{} for loading.
 func (env *FlatEnv) Decode() (interface{}, error) {
 	b, err := ioutil.ReadFile(env.Path)
@@ -97,9 +231,21 @@ func (env *FlatEnv) Decode() (interface{}, error) {
 
 	var f interface{}
 
-	err = yaml.Unmarshal(b, &f)
+	switch env.FileFormat() {
+	case FormatDotenv:
+		f, err = ParseDotenv(b, env.Expand)
+	case FormatTOML:
+		m := make(map[string]interface{})
+		err = toml.Unmarshal(b, &m)
+		f = m
+	case FormatYAML, FormatJSON:
+		err = yaml.Unmarshal(b, &f)
+	default:
+		err = fmt.Errorf("unknown format %q", env.Format)
+	}
+
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %s", env.Path, err)
 	}
 
 	return f, nil
@@ -118,7 +264,7 @@ func NewFlatEnv(path string) (map[string]string, error) {
 		return nil, err
 	}
 
-	err = env.Load(f, []string{})
+	err = env.Flatten(f)
 	if err != nil {
 		return nil, err
 	}
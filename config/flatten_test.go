@@ -1,6 +1,7 @@
 package config_test
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
@@ -86,3 +87,97 @@ func TestListValues(t *testing.T) {
 		}
 	}
 }
+
+func TestFlattenOptions(t *testing.T) {
+	data := map[string]interface{}{
+		"db": map[string]interface{}{
+			"host": "localhost",
+		},
+		"hosts": []interface{}{"a b", "c"},
+		"users": []interface{}{
+			map[string]interface{}{"name": "bob"},
+			map[string]interface{}{"name": "alice"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		options  config.FlattenOptions
+		expected map[string]string
+	}{
+		{
+			name: "default",
+			expected: map[string]string{
+				"db_host":    "localhost",
+				"hosts":      "a b c",
+				"users_name": "bob alice",
+			},
+		},
+		{
+			name:    "separator upper prefix",
+			options: config.FlattenOptions{Separator: "__", Upper: true, Prefix: "app"},
+			expected: map[string]string{
+				"APP__DB__HOST":    "localhost",
+				"APP__HOSTS":       "a b c",
+				"APP__USERS__NAME": "bob alice",
+			},
+		},
+		{
+			name:    "comma",
+			options: config.FlattenOptions{Lists: config.ListComma},
+			expected: map[string]string{
+				"db_host":    "localhost",
+				"hosts":      "a b,c",
+				"users_name": "bob,alice",
+			},
+		},
+		{
+			name:    "json",
+			options: config.FlattenOptions{Lists: config.ListJSON},
+			expected: map[string]string{
+				"db_host": "localhost",
+				"hosts":   `["a b","c"]`,
+				"users":   `[{"name":"bob"},{"name":"alice"}]`,
+			},
+		},
+		{
+			name:    "index",
+			options: config.FlattenOptions{Lists: config.ListIndex, Upper: true},
+			expected: map[string]string{
+				"DB_HOST":      "localhost",
+				"HOSTS_0":      "a b",
+				"HOSTS_1":      "c",
+				"USERS_0_NAME": "bob",
+				"USERS_1_NAME": "alice",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		fe := &config.FlatEnv{
+			Env:     make(map[string]string),
+			Options: tc.options,
+		}
+
+		err := fe.Flatten(data)
+		if err != nil {
+			t.Fatalf("%s: error flattening: %s", tc.name, err)
+		}
+
+		if !reflect.DeepEqual(fe.Env, tc.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, tc.expected, fe.Env)
+		}
+	}
+}
+
+func TestFlattenUnknownLists(t *testing.T) {
+	fe := &config.FlatEnv{
+		Env:     make(map[string]string),
+		Options: config.FlattenOptions{Lists: "semicolon"},
+	}
+
+	err := fe.Flatten(map[string]interface{}{"foo": "bar"})
+	if err == nil {
+		t.Fatal("expected an error for an unknown lists option")
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LoadXeConfig parses the config at path, recursively replacing any
+// include entries with the entries of the included files. Relative
+// includes are found relative to the including file and may be a glob.
+func LoadXeConfig(path string) ([]*XeConfig, error) {
+	return loadXeConfig(path, nil)
+}
+
+func loadXeConfig(path string, seen []string) ([]*XeConfig, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range seen {
+		if p == abs {
+			chain := append(append([]string{}, seen...), abs)
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	cfgs, err := NewXeConfig(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	seen = append(append([]string{}, seen...), abs)
+	return expandIncludes(cfgs, abs, seen)
+}
+
+// expandIncludes records where each entry came from and replaces the
+// include entries with the included entries.
+func expandIncludes(cfgs []*XeConfig, file string, seen []string) ([]*XeConfig, error) {
+	result := make([]*XeConfig, 0, len(cfgs))
+
+	for i, cfg := range cfgs {
+		cfg.file = file
+		cfg.index = i
+
+		if cfg.Post != nil {
+			post, err := expandIncludes(cfg.Post, file, seen)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Post = post
+		}
+
+		if cfg.Include == "" {
+			result = append(result, cfg)
+			continue
+		}
+
+		paths, err := includePaths(filepath.Dir(file), cfg.Include)
+		if err != nil {
+			return nil, fmt.Errorf("%s: include %s: %s", cfg.Location(), cfg.Include, err)
+		}
+
+		for _, path := range paths {
+			included, err := loadXeConfig(path, seen)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", cfg.Location(), err)
+			}
+			for _, inc := range included {
+				inc.includedBy(cfg)
+			}
+			result = append(result, included...)
+		}
+	}
+
+	return result, nil
+}
+
+// includedBy carries the when condition and secret of an include entry
+// onto an entry it included.
+func (cfg *XeConfig) includedBy(include *XeConfig) {
+	if include.When != "" {
+		cfg.includeWhen = append([]string{include.When}, cfg.includeWhen...)
+	}
+
+	if include.Secret {
+		cfg.setSecret()
+	}
+}
+
+// setSecret marks the entry and its post entries as secret.
+func (cfg *XeConfig) setSecret() {
+	cfg.Secret = true
+	for _, post := range cfg.Post {
+		post.setSecret()
+	}
+}
+
+// includePaths finds the files for an include relative to dir. A glob
+// that matches nothing is not an error, but a path that doesn't exist
+// is.
+func includePaths(dir, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
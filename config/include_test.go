@@ -0,0 +1,112 @@
+package config_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ionrock/xenv/config"
+)
+
+func TestInclude(t *testing.T) {
+	e, err := config.NewEnvironmentFromConfig("testdata/include/main.yml")
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	expected := map[string]string{
+		// The including file overrides the included value.
+		"NAME": "main",
+
+		// The command runs relative to the included file.
+		"BASE": "from base dir",
+
+		"A": "a",
+		"B": "b",
+	}
+
+	for k, v := range expected {
+		if result, _ := e.Config.Get(k); result != v {
+			t.Errorf("wrong value for %s: %q != %q", k, result, v)
+		}
+	}
+}
+
+func TestIncludeOrder(t *testing.T) {
+	cfgs, err := config.LoadXeConfig("testdata/include/main.yml")
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	if len(cfgs) != 4 {
+		t.Fatalf("wrong number of entries: %d", len(cfgs))
+	}
+
+	if !strings.HasSuffix(cfgs[0].Location(), "base.yml: entry 1") {
+		t.Errorf("wrong location for first entry: %s", cfgs[0].Location())
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	_, err := config.LoadXeConfig("testdata/include/cycle/a.yml")
+	if err == nil {
+		t.Fatalf("expected an error for an include cycle")
+	}
+
+	if !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("wrong error for an include cycle: %s", err)
+	}
+}
+
+func TestIncludeMissing(t *testing.T) {
+	_, err := config.LoadXeConfig("testdata/include/missing.yml")
+	if err == nil {
+		t.Fatalf("expected an error for a missing file")
+	}
+}
+
+func TestIncludeWhenAndSecret(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"prod.yml":  "- env:\n    - HOST: prod\n",
+		"dev.yml":   "- env:\n    - HOST: dev\n- include: token.yml\n  when: '{{ eq .TOKEN \"\" }}'\n",
+		"token.yml": "- env:\n    - TOKEN: abc\n",
+		"xe.yml": `---
+- env:
+    - ENV: dev
+- include: dev.yml
+  when: '{{ eq .ENV "dev" }}'
+  secret: true
+- include: prod.yml
+  when: '{{ eq .ENV "prod" }}'
+- env:
+    - ENV: prod
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	// The conditions are checked when the included entries run, so
+	// changing ENV afterwards doesn't matter.
+	expected := map[string]string{"HOST": "dev", "TOKEN": "abc", "ENV": "prod"}
+	for k, v := range expected {
+		if result, _ := e.Config.Get(k); result != v {
+			t.Errorf("wrong value for %s: %q != %q", k, result, v)
+		}
+	}
+
+	if !e.Config.IsSecret("HOST") || !e.Config.IsSecret("TOKEN") {
+		t.Errorf("expected the included values to be secret")
+	}
+	if e.Config.IsSecret("ENV") {
+		t.Errorf("expected ENV not to be secret")
+	}
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Inheritance modes.
+const (
+	// InheritAll passes on the whole environment of xenv.
+	InheritAll = "all"
+	// InheritNone passes on only the config.
+	InheritNone = "none"
+	// InheritAllowlist passes on the values matching the Allow
+	// patterns.
+	InheritAllowlist = "allowlist"
+)
+
+// Inherit configures which values of the environment xenv was started
+// with are passed on to the command, tasks, scripts, services and
+// templates. Values in the config always are.
+type Inherit struct {
+	// Mode is all, none or allowlist. The default is all.
+	Mode string `json:"mode"`
+
+	// Allow are patterns such as "LC_*" for the values passed on with
+	// the allowlist mode.
+	Allow []string `json:"allow"`
+
+	// Unset are patterns for values that are never passed on.
+	Unset []string `json:"unset"`
+}
+
+// UnmarshalJSON allows an Inherit to be only the mode.
+func (in *Inherit) UnmarshalJSON(b []byte) error {
+	var mode string
+	if err := json.Unmarshal(b, &mode); err == nil {
+		in.Mode = mode
+		return nil
+	}
+
+	type inherit Inherit
+	return json.Unmarshal(b, (*inherit)(in))
+}
+
+func (in *Inherit) check() error {
+	switch in.Mode {
+	case "", InheritAll, InheritNone, InheritAllowlist:
+	default:
+		return fmt.Errorf("unknown inherit mode %q, expected one of: all, none, allowlist", in.Mode)
+	}
+
+	for _, pattern := range append(append([]string{}, in.Allow...), in.Unset...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (in *Inherit) String() string {
+	if in.Mode == "" {
+		return InheritAll
+	}
+	return in.Mode
+}
+
+// inherits reports if the value k of the environment is passed on. A
+// nil Inherit passes on everything.
+func (in *Inherit) inherits(k string) bool {
+	if in == nil {
+		return true
+	}
+
+	if matchAny(in.Unset, k) {
+		return false
+	}
+
+	switch in.Mode {
+	case InheritNone:
+		return false
+	case InheritAllowlist:
+		return matchAny(in.Allow, k)
+	}
+	return true
+}
+
+func matchAny(patterns []string, k string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, k); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// environ returns the values of the environment that are inherited
+// with the config on top of them. An empty config value is the
+// inherited value when there is one.
+func (c *Config) environ(in *Inherit) []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	envlist := []string{}
+	inherited := make(map[string]string)
+
+	for _, envvar := range osEnviron() {
+		kv := strings.SplitN(envvar, "=", 2)
+		if len(kv) != 2 || !in.inherits(kv[0]) {
+			continue
+		}
+		inherited[kv[0]] = kv[1]
+
+		if _, ok := c.Data[kv[0]]; !ok {
+			envlist = append(envlist, envvar)
+		}
+	}
+
+	for _, key := range sortedKeys(c.Data) {
+		if key == "" {
+			continue
+		}
+
+		val := c.Data[key]
+		if val == "" && inherited[key] != "" {
+			val = inherited[key]
+		}
+
+		envlist = append(envlist, fmt.Sprintf("%s=%s", key, val))
+	}
+
+	return envlist
+}
@@ -0,0 +1,187 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ionrock/xenv/config"
+)
+
+// inheritVars are set in the environment of the tests.
+var inheritVars = map[string]string{
+	"XENV_INHERIT_ALLOWED": "a",
+	"XENV_INHERIT_OTHER":   "b",
+	"XENV_INHERIT_SECRET":  "c",
+}
+
+// inheritEcho prints the vars. The output starts with "=" to be valid
+// YAML for the envscript.
+const inheritEcho = `"=$XENV_INHERIT_ALLOWED,$XENV_INHERIT_OTHER,$XENV_INHERIT_SECRET"`
+
+func setInheritVars(t *testing.T) {
+	for k, v := range inheritVars {
+		err := os.Setenv(k, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func unsetInheritVars() {
+	for k := range inheritVars {
+		os.Unsetenv(k)
+	}
+}
+
+func TestInherit(t *testing.T) {
+	setInheritVars(t)
+	defer unsetInheritVars()
+
+	tests := []struct {
+		inherit  string
+		expected string
+	}{
+		{"", "=a,b,c"},
+		{"inherit: all", "=a,b,c"},
+		{"inherit: none", "=,,"},
+		{"inherit:\n    unset: [XENV_INHERIT_SEC*]", "=a,b,"},
+		{"inherit:\n    mode: allowlist\n    allow: [XENV_INHERIT_ALLOW*, XENV_INHERIT_SECRET]\n    unset: [XENV_INHERIT_SECRET]", "=a,,"},
+	}
+
+	for _, tc := range tests {
+		dir := writeFiles(t, map[string]string{
+			"inherit.tmpl": `={{ .XENV_INHERIT_ALLOWED | default "" }},{{ .XENV_INHERIT_OTHER | default "" }},{{ .XENV_INHERIT_SECRET | default "" }}` + "\n",
+		})
+		defer os.RemoveAll(dir)
+
+		cfg := "---\n"
+		if tc.inherit != "" {
+			cfg += "- " + tc.inherit + "\n"
+		}
+		cfg += `- env:
+    - VALUE: '` + "`echo " + inheritEcho + "`" + `'
+- envscript: 'echo "SCRIPT: ` + inheritEcho + `"'
+- task:
+    cmd: echo ` + inheritEcho + ` > task.txt
+- template:
+    template: inherit.tmpl
+    target: ` + filepath.Join(dir, "inherit.txt") + `
+- service:
+    name: svc
+    cmd: echo ` + inheritEcho + ` > service.txt; sleep 10
+`
+
+		err := ioutil.WriteFile(filepath.Join(dir, "xe.yml"), []byte(cfg), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e, err := runPre(t, dir)
+		if err != nil {
+			t.Fatalf("%q: error running config: %s", tc.inherit, err)
+		}
+
+		service := filepath.Join(dir, "service.txt")
+		for i := 0; i < 40; i++ {
+			if fi, err := os.Stat(service); err == nil && fi.Size() > 0 {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		e.StopServices()
+
+		for _, k := range []string{"VALUE", "SCRIPT"} {
+			if result, _ := e.Config.Get(k); result != tc.expected {
+				t.Errorf("%q: wrong env for %s: %q", tc.inherit, k, result)
+			}
+		}
+
+		for _, name := range []string{"task.txt", "inherit.txt", "service.txt"} {
+			if result := readFile(t, filepath.Join(dir, name)); result != tc.expected+"\n" {
+				t.Errorf("%q: wrong env for %s: %q", tc.inherit, name, result)
+			}
+		}
+	}
+}
+
+func TestInheritMain(t *testing.T) {
+	setInheritVars(t)
+	defer unsetInheritVars()
+
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- inherit:
+    mode: allowlist
+    allow: [XENV_INHERIT_ALLOWED]
+- watch:
+    disable: true
+- env:
+    - XENV_INHERIT_OTHER: config
+`,
+		"script.sh": "echo " + inheritEcho + " > main.txt\ntouch started\n",
+	})
+	defer os.RemoveAll(dir)
+
+	err := runMain(t, dir, "exec sh script.sh", func() {})
+	if err != nil {
+		t.Fatalf("error running main: %s", err)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "main.txt")); result != "=a,config,\n" {
+		t.Errorf("wrong env for the command: %q", result)
+	}
+}
+
+func TestInheritInvalid(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": "---\n- inherit: some\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := runPre(t, dir)
+	if err == nil {
+		t.Error("expected an error for the unknown mode")
+	}
+}
+
+func TestInheritRefresh(t *testing.T) {
+	setInheritVars(t)
+	defer unsetInheritVars()
+
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- inherit: none
+- watch:
+    interval: 0
+- env:
+    - VALUE: '` + "`echo " + inheritEcho + "`" + `'
+  refresh: 1m
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	watchers := e.Watchers()
+	if len(watchers) != 1 {
+		t.Fatalf("expected a refresh watcher, got %#v", watchers)
+	}
+
+	w, ok := watchers[0].(*config.PollWatcher)
+	if !ok {
+		t.Fatalf("expected a poll watcher, got %#v", watchers[0])
+	}
+
+	// The value is the same when it is run again with the same
+	// inherited environment.
+	changed, err := w.Check()
+	if err != nil || changed {
+		t.Errorf("expected no change, got %v, %v", changed, err)
+	}
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ionrock/xenv/templates"
+	"github.com/ionrock/xenv/util"
+)
+
+// PlanKey is an environment value an entry would set.
+type PlanKey struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// PlanStep describes what an entry would do when it is run.
+type PlanStep struct {
+	Location    string
+	Description string
+	Keys        []PlanKey
+
+	// Diff is the change a template would make to its target.
+	Diff string
+
+	// Post is set for entries that run after the command exits.
+	Post bool
+}
+
+// WritePlan writes the steps in order to w.
+func WritePlan(w io.Writer, steps []*PlanStep) error {
+	post := false
+	for i, step := range steps {
+		if step.Post && !post {
+			post = true
+			if _, err := fmt.Fprintln(w, "After the command exits:"); err != nil {
+				return err
+			}
+		}
+
+		_, err := fmt.Fprintf(w, "%d. %s: %s\n", i+1, step.Location, step.Description)
+		if err != nil {
+			return err
+		}
+
+		for _, k := range step.Keys {
+			_, err := fmt.Fprintf(w, "     %s=%s (%s)\n", k.Key, k.Value, k.Source)
+			if err != nil {
+				return err
+			}
+		}
+
+		if step.Diff != "" {
+			diff := strings.TrimSuffix(step.Diff, "\n")
+			for _, line := range strings.Split(diff, "\n") {
+				if _, err := fmt.Fprintf(w, "     %s\n", line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// planTemplate renders the templates in memory and records the
+// changes they would make to the targets.
+func (e *Environment) planTemplate(tmpl *templates.Renderer, dir string) error {
+	files, err := tmpl.Files(dir)
+	if err != nil {
+		return err
+	}
+
+	source := tmpl.Template
+	switch {
+	case tmpl.SourceDir != "":
+		source = tmpl.SourceDir
+	case tmpl.Content != "":
+		source = "inline template"
+	}
+
+	target := tmpl.Destination()
+	if len(files) == 1 {
+		target = files[0].Target
+	}
+
+	e.step.Description = fmt.Sprintf("render %s to %s", source, target)
+
+	diffs := []string{}
+	for _, f := range files {
+		rendered, err := tmpl.RenderFile(dir, f)
+		if err != nil {
+			return err
+		}
+
+		current, err := ioutil.ReadFile(f.Target)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		diff := util.UnifiedDiff(f.Target, f.Target+" (rendered)", current, rendered)
+		if diff != "" {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	e.step.Diff = e.Config.RedactString(strings.Join(diffs, ""))
+	if e.step.Diff == "" {
+		e.step.Description += " (unchanged)"
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package config_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ionrock/xenv/config"
+)
+
+func planConfig(t *testing.T, noExec bool) string {
+	e, err := config.NewEnvironmentFromConfig("testdata/plan/plan.yml")
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+	e.Planning = true
+	e.NoExec = noExec
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error planning config: %s", err)
+	}
+
+	err = e.Post()
+	if err != nil {
+		t.Fatalf("error planning post: %s", err)
+	}
+
+	var b bytes.Buffer
+	err = config.WritePlan(&b, e.Plan)
+	if err != nil {
+		t.Fatalf("error writing plan: %s", err)
+	}
+
+	return b.String()
+}
+
+func TestPlan(t *testing.T) {
+	plan := planConfig(t, false)
+
+	expected := []string{
+		"NAME=world (value)",
+		"GREETING=hello (command `echo hello`)",
+		"-hello everyone",
+		"+hello world",
+		"run task greet: cat greeting.txt",
+		"After the command exits:",
+		"run task cleanup: rm greeting.txt",
+	}
+
+	for _, s := range expected {
+		if !strings.Contains(plan, s) {
+			t.Errorf("missing %q from plan:\n%s", s, plan)
+		}
+	}
+
+	// Nothing should have been written or removed.
+	b, err := ioutil.ReadFile("testdata/plan/greeting.txt")
+	if err != nil || string(b) != "hello everyone\n" {
+		t.Errorf("template target changed: %q %v", b, err)
+	}
+}
+
+func TestPlanNoExec(t *testing.T) {
+	plan := planConfig(t, true)
+
+	expected := "GREETING=`echo hello` (command not run)"
+	if !strings.Contains(plan, expected) {
+		t.Errorf("missing %q from plan:\n%s", expected, plan)
+	}
+}
+
+func TestPlanTemplateDir(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- env:
+    - NAME: world
+- template:
+    source_dir: src
+    target_dir: out
+    strip_extension: .tmpl
+- template:
+    content: "inline {{ .NAME }}\n"
+    target: inline.txt
+`,
+		"src/a.txt.tmpl": "a {{ .NAME }}\n",
+		"src/b.txt.tmpl": "b {{ .NAME }}\n",
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := config.NewEnvironmentFromConfig(filepath.Join(dir, "xe.yml"))
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+	e.Planning = true
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error planning config: %s", err)
+	}
+
+	var b bytes.Buffer
+	err = config.WritePlan(&b, e.Plan)
+	if err != nil {
+		t.Fatalf("error writing plan: %s", err)
+	}
+	plan := b.String()
+
+	expected := []string{
+		"render src to out",
+		"+a world",
+		"+b world",
+		"render inline template to " + filepath.Join(dir, "inline.txt"),
+		"+inline world",
+	}
+	for _, s := range expected {
+		if !strings.Contains(plan, s) {
+			t.Errorf("missing %q from plan:\n%s", s, plan)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "out")); err == nil {
+		t.Error("expected the target dir not to be written")
+	}
+}
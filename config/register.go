@@ -0,0 +1,138 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// ParseLines reads the output of a task as a list with an item for
+// each line.
+const ParseLines = "lines"
+
+// checkParse checks the way the output of the task is read.
+func (t *XeTask) checkParse() error {
+	switch t.Parse {
+	case "", FormatYAML, FormatJSON, ParseLines:
+		return nil
+	}
+	return fmt.Errorf("unknown parse %q, expected one of: yaml, json, lines", t.Parse)
+}
+
+// parsed parses the output of the task. Without a parse the output is
+// trimmed.
+func (t *XeTask) parsed(out string) (interface{}, error) {
+	var v interface{}
+	switch t.Parse {
+	case "":
+		v = strings.TrimSpace(out)
+
+	case FormatYAML:
+		err := yaml.Unmarshal([]byte(out), &v)
+		if err != nil {
+			return nil, err
+		}
+
+	case FormatJSON:
+		err := json.Unmarshal([]byte(out), &v)
+		if err != nil {
+			return nil, err
+		}
+
+	case ParseLines:
+		lines := []interface{}{}
+		for _, line := range strings.Split(out, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		v = lines
+	}
+	return v, nil
+}
+
+// registered parses the output of the task and returns it with the
+// values to register.
+func (t *XeTask) registered(out string) (interface{}, map[string]string, error) {
+	v, err := t.parsed(out)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if t.Parse == "" {
+		return v, map[string]string{t.Register: v.(string)}, nil
+	}
+
+	env := &FlatEnv{
+		Env:     make(map[string]string),
+		Options: t.FlattenOptions,
+	}
+
+	err = env.Flatten(map[string]interface{}{t.Register: v})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return v, env.Env, nil
+}
+
+// dataPath returns the path of the output in the structured data.
+func (t *XeTask) dataPath() []string {
+	if t.Parse == "" {
+		return []string{t.Register}
+	}
+	return dataPath(t.FlattenOptions, t.Register)
+}
+
+// register sets the values from the output of the task of an entry.
+func (e *Environment) register(cfg *XeConfig, out string) error {
+	v, values, err := cfg.Task.registered(out)
+	if err != nil {
+		return fmt.Errorf("error parsing output of task %s: %s", cfg.Task.Name, err)
+	}
+	e.Config.SetData(cfg.Task.dataPath(), v)
+
+	src := cfg.source(SourceTask, cfg.Task.Cmd.String())
+	for _, k := range sortedKeys(values) {
+		e.set(k, values[k], src, src.Describe())
+	}
+
+	return nil
+}
+
+// keepRegistered sets the values and data the task of an entry
+// registered in the previous config again. The task doesn't run when only the data
+// is built, so this keeps its values from looking like they were
+// removed.
+func (e *Environment) keepRegistered(cfg *XeConfig) {
+	if e.previous == nil {
+		return
+	}
+
+	for k, src := range e.previous.setBy(cfg.file, cfg.index) {
+		e.Config.SetFrom(k, src.Value, src)
+	}
+
+	if cfg.Task.Register == "" {
+		return
+	}
+
+	if v := e.previous.dataAt(cfg.Task.dataPath()); v != nil {
+		e.Config.SetData(cfg.Task.dataPath(), v)
+	}
+}
+
+// logUnregistered logs the output of a task that failed to register
+// its output, unless the values would have been secret.
+func (e *Environment) logUnregistered(cfg *XeConfig, t *Task, stdout []string) {
+	if cfg.Secret || e.Config.IsSecret(cfg.Task.Register) {
+		t.log().Warn("Not logging the output of the failed task as it is secret")
+		return
+	}
+
+	for _, line := range stdout {
+		t.log().Info(line)
+	}
+}
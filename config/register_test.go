@@ -0,0 +1,208 @@
+package config_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ionrock/xenv/config"
+)
+
+func TestTaskRegister(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- task:
+    name: version
+    cmd: echo '  1.2.3  '
+    register: VERSION
+- task:
+    name: service
+    cmd: "echo '{\"host\": \"db\", \"ports\": [5432, 5433]}'"
+    register: DB
+    parse: json
+- task:
+    name: hosts
+    cmd: printf 'a\n\nb\nc'
+    register: HOSTS
+    parse: lines
+    lists: comma
+- task:
+    name: settings
+    cmd: "printf 'debug: true\nlevel: info\n'"
+    register: SETTINGS
+    parse: yaml
+- task:
+    name: after
+    cmd: echo $VERSION $DB_host > after.txt
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	expected := map[string]string{
+		"VERSION":        "1.2.3",
+		"DB_host":        "db",
+		"DB_ports":       "5432 5433",
+		"HOSTS":          "a,b,c",
+		"SETTINGS_debug": "true",
+		"SETTINGS_level": "info",
+	}
+	for k, v := range expected {
+		if result, _ := e.Config.Get(k); result != v {
+			t.Errorf("wrong value for %s: %q", k, result)
+		}
+	}
+
+	if result := readFile(t, filepath.Join(dir, "after.txt")); result != "1.2.3 db\n" {
+		t.Errorf("later task didn't see the values: %q", result)
+	}
+
+	sources := e.Config.Explain("VERSION")
+	if last := sources[len(sources)-1]; last.Kind != config.SourceTask {
+		t.Errorf("expected the value to come from the task: %s", last)
+	}
+}
+
+func TestTaskRegisterErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		task     string
+		expected string
+	}{
+		{
+			name:     "unknown parse",
+			task:     "cmd: echo hi\n    register: FOO\n    parse: xml",
+			expected: `unknown parse "xml"`,
+		},
+		{
+			name:     "invalid output",
+			task:     "cmd: echo '{'\n    register: FOO\n    parse: json",
+			expected: "error parsing output of task",
+		},
+	}
+
+	for _, tc := range tests {
+		dir := writeFiles(t, map[string]string{
+			"xe.yml": "---\n- task:\n    " + tc.task + "\n",
+		})
+		defer os.RemoveAll(dir)
+
+		_, err := runPre(t, dir)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: expected an error with %q, got %v", tc.name, tc.expected, err)
+		}
+	}
+}
+
+func TestTaskRegisterIgnoreErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- task:
+    name: fails
+    cmd: "echo '{\"host\": \"db\"}'; exit 3"
+    register: DB
+    parse: json
+    ignore_errors: true
+- env:
+    - AFTER: set
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("expected the error to be ignored: %s", err)
+	}
+
+	if _, ok := e.Config.Get("DB_host"); ok {
+		t.Error("expected nothing to be registered for the failed task")
+	}
+
+	if result, _ := e.Config.Get("AFTER"); result != "set" {
+		t.Errorf("expected the next entry to run: %q", result)
+	}
+}
+
+func TestTaskRegisterSecret(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- secrets: ["*_TOKEN"]
+- task:
+    name: fetch
+    cmd: echo s3cr3t-pattern
+    register: API_TOKEN
+- task:
+    name: fetch-secret
+    cmd: echo s3cr3t-entry
+    register: OTHER
+  secret: true
+- task:
+    name: fetch-failed
+    cmd: echo s3cr3t-failed; exit 1
+    register: FAILED_TOKEN
+    ignore_errors: true
+- task:
+    name: fetch-visible
+    cmd: echo visible-value
+    register: VISIBLE
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := config.NewEnvironmentFromConfig(filepath.Join(dir, "xe.yml"))
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	var b bytes.Buffer
+	std := log.StandardLogger()
+	out, hooks := std.Out, std.Hooks
+	std.Out, std.Hooks = &b, make(log.LevelHooks)
+	defer func() { std.Out, std.Hooks = out, hooks }()
+	std.Hooks.Add(config.NewRedactHook(e.Config))
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	if strings.Contains(b.String(), "s3cr3t") {
+		t.Errorf("secret found in log output: %s", b.String())
+	}
+
+	if !strings.Contains(b.String(), "visible-value") {
+		t.Errorf("expected the output of other tasks to be logged: %s", b.String())
+	}
+}
+
+func TestTaskRegisterKeptWhenWatching(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- watch:
+    interval: 0.05
+- on_change:
+    restart: true
+- task:
+    cmd: date +%N
+    register: NOW
+`,
+		"script.sh": "echo run >> runs.txt\ntouch started\nsleep 0.6\n",
+	})
+	defer os.RemoveAll(dir)
+
+	err := runMain(t, dir, "exec sh script.sh", func() {})
+	if err != nil {
+		t.Fatalf("error running main: %s", err)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "runs.txt")); result != "run\n" {
+		t.Errorf("expected the registered value to be kept, the command ran %d times", strings.Count(result, "\n"))
+	}
+}
@@ -0,0 +1,280 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codeskyblue/kexec"
+	"github.com/ionrock/xenv/templates"
+)
+
+// OnChange is what happens when the config data changes while the
+// command runs. By default the command is stopped.
+type OnChange struct {
+	// Signal is sent to the command instead of stopping it, such as
+	// SIGHUP.
+	Signal string `json:"signal"`
+
+	// Restart restarts the command with the new environment.
+	Restart bool `json:"restart"`
+
+	// Task is the name of a task entry to run.
+	Task string `json:"task"`
+
+	// Ignore is a list of patterns such as "*_TTL" for keys that
+	// don't count as a change.
+	Ignore []string `json:"ignore"`
+}
+
+func (oc *OnChange) check() error {
+	if oc.Signal != "" && oc.Restart {
+		return errors.New("on_change can't both send a signal and restart")
+	}
+
+	if oc.Signal != "" {
+		if _, err := parseSignal(oc.Signal); err != nil {
+			return err
+		}
+	}
+
+	for _, pattern := range oc.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad ignore pattern %q: %s", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// exits reports if the command is stopped on a change.
+func (oc *OnChange) exits() bool {
+	return oc == nil || (oc.Signal == "" && !oc.Restart && oc.Task == "")
+}
+
+func (oc *OnChange) String() string {
+	if oc.exits() {
+		return "exit"
+	}
+
+	actions := []string{"render templates"}
+	if oc.Task != "" {
+		actions = append(actions, "run task "+oc.Task)
+	}
+	if oc.Signal != "" {
+		actions = append(actions, "send "+oc.Signal)
+	}
+	if oc.Restart {
+		actions = append(actions, "restart")
+	}
+	return strings.Join(actions, ", ")
+}
+
+type reloadAction int
+
+const (
+	// reloadNone keeps the command running.
+	reloadNone reloadAction = iota
+	// reloadExit stops the command.
+	reloadExit
+	// reloadRestart restarts the command.
+	reloadRestart
+)
+
+// ignored reports if changes to the key are ignored.
+func (e *Environment) ignored(k string) bool {
+	if e.onChange == nil {
+		return false
+	}
+
+	for _, pattern := range e.onChange.Ignore {
+		if ok, _ := path.Match(pattern, k); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTemplate checks a template and its on_change hook.
+func checkTemplate(tmpl *templates.Renderer) error {
+	err := tmpl.Check()
+	if err != nil {
+		return err
+	}
+	return checkHook(tmpl.OnChange)
+}
+
+// checkHook checks the on_change hook of a template.
+func checkHook(hook *templates.OnChange) error {
+	if hook == nil {
+		return nil
+	}
+
+	if hook.Signal != "" && hook.Restart {
+		return errors.New("on_change can't both send a signal and restart")
+	}
+
+	if hook.Signal != "" {
+		_, err := parseSignal(hook.Signal)
+		return err
+	}
+	return nil
+}
+
+// reload rebuilds the config and renders the templates again in
+// memory after a change was found. The templates whose output changed
+// are written and their on_change hooks are run. When the config data
+// changed, the on_change policy is applied too. The command is only
+// stopped when the data changed and neither the policy nor the hooks
+// of the changed templates keep it running. It returns what should
+// happen to the command.
+func (e *Environment) reload(cmd *kexec.KCommand) (reloadAction, error) {
+	oc := e.onChange
+
+	ne, err := NewEnvironmentFromConfig(e.ConfigFile)
+	if err != nil {
+		return reloadNone, err
+	}
+
+	ne.DataOnly = true
+	ne.previous = e.Config
+	err = ne.Pre()
+	if err != nil {
+		return reloadNone, err
+	}
+
+	// Watchers may find the same change more than once.
+	e.mu.RLock()
+	dataChanged := e.changed(ne.Config)
+	changedTemplates, err := e.changedTemplates(ne)
+	e.mu.RUnlock()
+	if err != nil {
+		return reloadNone, err
+	}
+
+	if !dataChanged && len(changedTemplates) == 0 {
+		return reloadNone, nil
+	}
+
+	hooks := []*templates.OnChange{}
+	for _, cfg := range changedTemplates {
+		if cfg.Template.OnChange != nil {
+			hooks = append(hooks, cfg.Template.OnChange)
+		}
+	}
+
+	if dataChanged && oc.exits() && len(hooks) == 0 {
+		return reloadExit, nil
+	}
+
+	// The config is updated in place as the log hook refers to it.
+	e.mu.Lock()
+	if dataChanged {
+		e.Config.replace(ne.Config)
+	}
+	err = e.renderTemplates(changedTemplates, ne)
+	e.mu.Unlock()
+	if err != nil {
+		return reloadNone, err
+	}
+
+	if dataChanged && !oc.exits() {
+		hooks = append([]*templates.OnChange{{Task: oc.Task, Signal: oc.Signal, Restart: oc.Restart}}, hooks...)
+	}
+
+	return e.runHooks(cmd, hooks, ne.tasks)
+}
+
+// runHooks runs the tasks of the hooks once each, then restarts the
+// command or sends it the signals.
+func (e *Environment) runHooks(cmd *kexec.KCommand, hooks []*templates.OnChange, tasks map[string]*XeConfig) (reloadAction, error) {
+	ran := make(map[string]bool)
+	restart := false
+	for _, hook := range hooks {
+		restart = restart || hook.Restart
+
+		if hook.Task == "" || ran[hook.Task] {
+			continue
+		}
+		ran[hook.Task] = true
+
+		task, ok := tasks[hook.Task]
+		if !ok {
+			return reloadNone, fmt.Errorf("on_change: unknown task %s", hook.Task)
+		}
+
+		log.WithField("task", hook.Task).Info("Running on change task")
+		err := e.runTaskEntry(task, e.entryDir(task))
+		if err != nil {
+			return reloadNone, err
+		}
+	}
+
+	if restart {
+		return reloadRestart, nil
+	}
+
+	sent := make(map[string]bool)
+	for _, hook := range hooks {
+		if hook.Signal == "" || sent[hook.Signal] {
+			continue
+		}
+		sent[hook.Signal] = true
+
+		sig, err := parseSignal(hook.Signal)
+		if err != nil {
+			return reloadNone, err
+		}
+
+		log.WithField("signal", hook.Signal).Info("Configuration data changed. Sending signal...")
+		err = signalGroup(cmd, sig)
+		if err != nil {
+			return reloadNone, err
+		}
+	}
+
+	return reloadNone, nil
+}
+
+// changedTemplates renders the templates of the config in memory with
+// the data of ne and returns the entries whose output is different from their
+// targets.
+func (e *Environment) changedTemplates(ne *Environment) ([]*XeConfig, error) {
+	changed := []*XeConfig{}
+	for _, cfg := range e.watched {
+		if cfg.Template == nil {
+			continue
+		}
+
+		tmpl := *cfg.Template
+		ne.setTemplateData(&tmpl)
+		ok, err := templateChanged(&tmpl, e.entryDir(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", cfg.Location(), err)
+		}
+
+		if ok {
+			changed = append(changed, cfg)
+		}
+	}
+	return changed, nil
+}
+
+// renderTemplates writes the templates of the entries with the data of
+// ne.
+func (e *Environment) renderTemplates(cfgs []*XeConfig, ne *Environment) error {
+	for _, cfg := range cfgs {
+		ne.setTemplateData(cfg.Template)
+		changed, err := cfg.Template.Execute(e.entryDir(cfg))
+		if err != nil {
+			return fmt.Errorf("%s: %s", cfg.Location(), err)
+		}
+
+		if changed {
+			log.WithField("target", cfg.Template.Destination()).Info("Template changed")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ionrock/xenv/config"
+)
+
+// writeFiles writes the files to a new temp dir and returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "xenv-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// runMain runs the config in dir with the command until the command
+// exits, calling change once the command has started. It returns the
+// result of Main.
+func runMain(t *testing.T, dir, command string, change func()) error {
+	e, err := config.NewEnvironmentFromConfig(filepath.Join(dir, "xe.yml"))
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e.Main([]string{"sh", "-c", "cd " + dir + "; " + command})
+	}()
+
+	started := filepath.Join(dir, "started")
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(started); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Give the watchers time to start.
+	time.Sleep(200 * time.Millisecond)
+	change()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("main did not exit")
+	}
+	return nil
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestOnChangeSignal(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app.env":  "FOO=bar\n",
+		"foo.tmpl": "foo={{ .FOO }}\n",
+	})
+	defer os.RemoveAll(dir)
+
+	cfg := `---
+- watch:
+    interval: 0
+- on_change:
+    signal: SIGHUP
+    task: reloaded
+- envfile: app.env
+- template:
+    template: foo.tmpl
+    target: ` + filepath.Join(dir, "foo.txt") + `
+- task:
+    name: reloaded
+    cmd: echo $FOO >> tasks.txt
+`
+	err := ioutil.WriteFile(filepath.Join(dir, "xe.yml"), []byte(cfg), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = runMain(t, dir, `touch started; trap "exit 0" HUP; while :; do sleep 0.05; done`, func() {
+		err := ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("FOO=baz\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("error running main: %s", err)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "foo.txt")); result != "foo=baz\n" {
+		t.Errorf("template was not rendered again: %q", result)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "tasks.txt")); result != "bar\nbaz\n" {
+		t.Errorf("task was not run on change: %q", result)
+	}
+}
+
+func TestOnChangeRestart(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- watch:
+    interval: 0
+- on_change:
+    restart: true
+- envfile: app.env
+`,
+		"app.env": "FOO=bar\n",
+	})
+	defer os.RemoveAll(dir)
+
+	command := `echo $FOO >> runs.txt; touch started; [ "$FOO" = baz ] && exit 0; trap "exit 0" INT; while :; do sleep 0.05; done`
+	err := runMain(t, dir, command, func() {
+		err := ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("FOO=baz\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("error running main: %s", err)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "runs.txt")); result != "bar\nbaz\n" {
+		t.Errorf("command was not restarted with the new env: %q", result)
+	}
+}
+
+func TestOnChangeIgnore(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- watch:
+    interval: 0
+- on_change:
+    ignore:
+      - "*_TTL"
+- envfile: app.env
+`,
+		"app.env": "FOO=bar\nCACHE_TTL=10\n",
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := config.NewEnvironmentFromConfig(filepath.Join(dir, "xe.yml"))
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	events := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+
+	for _, w := range e.Watchers() {
+		err := w.Watch(events, stop)
+		if err != nil {
+			t.Fatalf("error starting watcher: %s", err)
+		}
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("FOO=bar\nCACHE_TTL=20\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-events:
+		t.Fatal("unexpected change event for an ignored key")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("FOO=baz\nCACHE_TTL=20\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitForEvent(t, events)
+}
+
+func TestOnChangeInvalid(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": "---\n- on_change:\n    signal: SIGNOPE\n",
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := config.NewEnvironmentFromConfig(filepath.Join(dir, "xe.yml"))
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	err = e.Pre()
+	if err == nil || !strings.Contains(err.Error(), "unknown signal") {
+		t.Errorf("expected an unknown signal error, got %v", err)
+	}
+}
+
+func TestTemplateOnChange(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app.env":  "FOO=bar\nBAR=bar\n",
+		"foo.tmpl": "foo={{ .FOO }}\n",
+		"bar.tmpl": "bar={{ .BAR }}\n",
+	})
+	defer os.RemoveAll(dir)
+
+	cfg := `---
+- watch:
+    interval: 0
+- envfile: app.env
+- template:
+    template: foo.tmpl
+    target: ` + filepath.Join(dir, "foo.txt") + `
+    on_change:
+      task: foo-changed
+      signal: SIGHUP
+- template:
+    template: bar.tmpl
+    target: ` + filepath.Join(dir, "bar.txt") + `
+    on_change:
+      task: bar-changed
+- task:
+    name: foo-changed
+    cmd: echo $FOO >> foo-tasks.txt
+- task:
+    name: bar-changed
+    cmd: echo $BAR >> bar-tasks.txt
+`
+	err := ioutil.WriteFile(filepath.Join(dir, "xe.yml"), []byte(cfg), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = runMain(t, dir, `touch started; trap "echo hup > hup.txt; exit 0" HUP; while :; do sleep 0.05; done`, func() {
+		err := ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("FOO=baz\nBAR=bar\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("error running main: %s", err)
+	}
+
+	expected := map[string]string{
+		"foo.txt":       "foo=baz\n",
+		"foo-tasks.txt": "bar\nbaz\n",
+		"bar-tasks.txt": "bar\n",
+		"hup.txt":       "hup\n",
+	}
+	for name, v := range expected {
+		if result := readFile(t, filepath.Join(dir, name)); result != v {
+			t.Errorf("wrong content for %s: %q", name, result)
+		}
+	}
+}
+
+func TestTemplateOnChangeSourceEdited(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"foo.tmpl": "foo={{ .FOO }}\n",
+	})
+	defer os.RemoveAll(dir)
+
+	cfg := `---
+- watch:
+    interval: 0
+- env:
+    - FOO: bar
+- template:
+    template: foo.tmpl
+    target: ` + filepath.Join(dir, "foo.txt") + `
+    on_change:
+      restart: true
+`
+	err := ioutil.WriteFile(filepath.Join(dir, "xe.yml"), []byte(cfg), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	command := `cat foo.txt >> runs.txt; touch started; grep -q v2 foo.txt && exit 0; trap "exit 0" INT; while :; do sleep 0.05; done`
+	err = runMain(t, dir, command, func() {
+		err := ioutil.WriteFile(filepath.Join(dir, "foo.tmpl"), []byte("foo={{ .FOO }} v2\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("error running main: %s", err)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "runs.txt")); result != "foo=bar\nfoo=bar v2\n" {
+		t.Errorf("expected a restart with the new template: %q", result)
+	}
+}
+
+func TestTemplateOnChangeInvalid(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"foo.tmpl": "foo\n",
+	})
+	defer os.RemoveAll(dir)
+
+	cfg := "---\n- template:\n    template: foo.tmpl\n    target: " + filepath.Join(dir, "foo.txt") +
+		"\n    on_change:\n      signal: SIGHUP\n      restart: true\n"
+	err := ioutil.WriteFile(filepath.Join(dir, "xe.yml"), []byte(cfg), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = runPre(t, dir)
+	if err == nil || !strings.Contains(err.Error(), "can't both send a signal and restart") {
+		t.Errorf("expected an error for the hook, got %v", err)
+	}
+}
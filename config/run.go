@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ionrock/xenv/reaper"
+)
+
+// DefaultRetryDelay is the delay before the first retry when the
+// retry_delay isn't set.
+const DefaultRetryDelay = time.Second
+
+// RunOptions control how the command of a task, envscript or value is
+// run.
+type RunOptions struct {
+	// Timeout kills the command when it runs longer. Zero means there
+	// is no timeout.
+	Timeout Duration `json:"timeout"`
+
+	// Retries is how many more times a failed command is run.
+	Retries int `json:"retries"`
+
+	// RetryDelay is the delay before the first retry. It doubles with
+	// each retry. The default is 1s.
+	RetryDelay *Duration `json:"retry_delay"`
+
+	// IgnoreErrors logs the error of a command that failed every
+	// attempt instead of returning it.
+	IgnoreErrors bool `json:"ignore_errors"`
+}
+
+// or returns the options, or def when none of them are set.
+func (o RunOptions) or(def RunOptions) RunOptions {
+	if o == (RunOptions{}) {
+		return def
+	}
+	return o
+}
+
+// delay returns how long to wait before the given retry, starting
+// with 0.
+func (o RunOptions) delay(retry int) time.Duration {
+	d := DefaultRetryDelay
+	if o.RetryDelay != nil {
+		d = o.RetryDelay.Std()
+	}
+	for i := 0; i < retry; i++ {
+		d *= 2
+	}
+	return d
+}
+
+// prepare puts the command in its own process group when there is a
+// timeout so the whole command can be killed.
+func (o RunOptions) prepare(cmd *exec.Cmd) {
+	if o.Timeout <= 0 {
+		return
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// killAfter kills the process group of the started command when it
+// runs past the timeout. The returned function stops the timer and
+// reports if the command was killed.
+func (o RunOptions) killAfter(cmd *exec.Cmd) func() bool {
+	if o.Timeout <= 0 {
+		return func() bool { return false }
+	}
+
+	var killed int32
+	pgid := cmd.Process.Pid
+	timer := time.AfterFunc(o.Timeout.Std(), func() {
+		atomic.StoreInt32(&killed, 1)
+		syscall.Kill(-pgid, syscall.SIGKILL)
+	})
+
+	return func() bool {
+		timer.Stop()
+		return atomic.LoadInt32(&killed) == 1
+	}
+}
+
+// timeoutError is the error of a command that was killed because it
+// ran past the timeout.
+type timeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.timeout)
+}
+
+// wait waits for the command with killAfter, returning a timeoutError
+// when it was killed.
+func (o RunOptions) wait(cmd *exec.Cmd, killed func() bool) error {
+	err := cmd.Wait()
+	if killed() {
+		return &timeoutError{timeout: o.Timeout.Std(), err: err}
+	}
+	return err
+}
+
+// retry calls attempt until it succeeds or there are no retries left,
+// logging the exit code of each attempt. The error of the last attempt
+// is returned unless errors are ignored.
+func (o RunOptions) retry(logCtx *log.Entry, attempt func() error) error {
+	var err error
+	for i := 0; i <= o.Retries; i++ {
+		if i > 0 {
+			d := o.delay(i - 1)
+			logCtx.WithField("delay", d).Info("Retrying")
+			time.Sleep(d)
+		}
+
+		err = attempt()
+
+		attemptLog := logCtx.WithFields(log.Fields{
+			"attempt":   i + 1,
+			"exit_code": exitCode(err),
+		})
+		if err == nil {
+			attemptLog.Info("Command succeeded")
+			return nil
+		}
+		attemptLog.WithError(err).Warn("Command failed")
+	}
+
+	if o.IgnoreErrors {
+		logCtx.WithError(err).Warn("Ignoring error")
+		return nil
+	}
+	return err
+}
+
+// exitCode returns the exit code for the error of a command. It is -1
+// when the command didn't run.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if timeoutErr, ok := err.(*timeoutError); ok {
+		err = timeoutErr.err
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return reaper.ExitCode(status)
+		}
+	}
+	return -1
+}
@@ -0,0 +1,240 @@
+package config_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flaky is a script that fails until it has run the given number of
+// times, counting the runs in runs.txt.
+const flaky = `echo run >> runs.txt
+[ $(wc -l < runs.txt) -ge %d ]
+`
+
+func TestTaskRetries(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- task:
+    name: register
+    cmd: sh flaky.sh
+    retries: 2
+    retry_delay: 0.01
+`,
+		"flaky.sh": fmt.Sprintf(flaky, 3),
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("expected the task to succeed on the last retry: %s", err)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "runs.txt")); result != "run\nrun\nrun\n" {
+		t.Errorf("wrong number of runs: %q", result)
+	}
+}
+
+func TestTaskRetriesFail(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- task:
+    name: register
+    cmd: sh flaky.sh
+    retries: 1
+    retry_delay: 0.01
+`,
+		"flaky.sh": fmt.Sprintf(flaky, 3),
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := runPre(t, dir)
+	if err == nil || !strings.Contains(err.Error(), "exit status 1") {
+		t.Errorf("expected the last error, got %v", err)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "runs.txt")); result != "run\nrun\n" {
+		t.Errorf("wrong number of runs: %q", result)
+	}
+}
+
+func TestTaskTimeout(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- task:
+    name: hangs
+    cmd: sleep 5 && touch done.txt
+    timeout: 0.2
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+	_, err := runPre(t, dir)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 200ms") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the task to be killed, took %s", elapsed)
+	}
+}
+
+func TestTaskIgnoreErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- task:
+    name: fails
+    cmd: exit 2
+    ignore_errors: true
+- task:
+    name: after
+    cmd: touch after.txt
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("expected the error to be ignored: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "after.txt")); err != nil {
+		t.Error("expected the next task to run")
+	}
+}
+
+func TestEnvScriptIgnoreErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- envscript:
+    cmd: "echo 'FOO: bar'; exit 3"
+    ignore_errors: true
+- env:
+    - AFTER: set
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("expected the error to be ignored: %s", err)
+	}
+
+	if _, ok := e.Config.Get("FOO"); ok {
+		t.Error("expected the output of the failed script to be ignored")
+	}
+
+	if result, _ := e.Config.Get("AFTER"); result != "set" {
+		t.Errorf("expected the next entry to run: %q", result)
+	}
+}
+
+func TestEnvScriptRetries(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- envscript:
+    cmd: "sh flaky.sh && echo 'FOO: bar'"
+    retries: 1
+    retry_delay: 0
+`,
+		"flaky.sh": fmt.Sprintf(flaky, 2),
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	if result, _ := e.Config.Get("FOO"); result != "bar" {
+		t.Errorf("wrong value: %q", result)
+	}
+}
+
+func TestEnvScriptValueFails(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": "---\n- envscript: sh script.sh\n  timeout: 0.2\n",
+		// The value of FOO is a command that is run by xenv.
+		"script.sh": "echo 'FOO: \"`sleep 5`\"'\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := runPre(t, dir)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected the value to time out, got %v", err)
+	}
+}
+
+func TestEntryRunOptions(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- task:
+    name: slow
+    cmd: sleep 5
+  timeout: 0.2
+  ignore_errors: true
+- envscript: "sleep 5; echo 'FOO: bar'"
+  timeout: 0.2
+  ignore_errors: true
+- task:
+    name: own
+    cmd: sh flaky.sh
+    retries: 1
+    retry_delay: 0
+  timeout: 0.2
+`,
+		"flaky.sh": fmt.Sprintf(flaky, 2),
+	})
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the task and envscript to time out, took %s", elapsed)
+	}
+
+	if result, _ := e.Config.Get("FOO"); result != "" {
+		t.Errorf("expected no value from the envscript: %q", result)
+	}
+}
+
+func TestValueRunOptions(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- env:
+    - SLOW: '` + "`sleep 5; echo slow`" + `'
+  timeout: 0.2
+  ignore_errors: true
+- env:
+    - FLAKY: '` + "`sh flaky.sh && echo ok`" + `'
+  retries: 1
+  retry_delay: 0
+`,
+		"flaky.sh": fmt.Sprintf(flaky, 2),
+	})
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the value to time out, took %s", elapsed)
+	}
+
+	for k, v := range map[string]string{"SLOW": "", "FLAKY": "ok"} {
+		if result, _ := e.Config.Get(k); result != v {
+			t.Errorf("wrong value for %s: %q", k, result)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"bytes"
 	"os/exec"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/ghodss/yaml"
 )
 
@@ -12,21 +14,51 @@ type Script struct {
 	Cmd string
 	Dir string
 	Env []string
+
+	// Args are the program and its arguments to run instead. When
+	// they are empty the Cmd is run with util.DefaultShell().
+	Args []string
+
+	// Options control how the output is flattened.
+	Options FlattenOptions
+
+	// RunOptions set the timeout and retries of the script.
+	RunOptions RunOptions
 }
 
 // Load executes the script using the specified *Config for the
 // environment. The result is parsed and flattened before returning a
-// map[string]string.
+// map[string]string. A failed script is retried according to the
+// RunOptions and when its errors are ignored the result is empty.
 func (e Script) Load() (map[string]string, error) {
-	cmd := exec.Command("/bin/bash", "-c", e.Cmd)
-	cmd.Dir = e.Dir
-	cmd.Env = e.Env
+	f, err := e.Decode()
+	if err != nil {
+		return nil, err
+	}
 
-	buf, err := cmd.Output()
+	return e.flatten(f)
+}
+
+// Decode executes the script and parses its output without flattening
+// it. The result is an empty map when the script failed and its errors
+// are ignored.
+func (e Script) Decode() (interface{}, error) {
+	var buf []byte
+	failed := false
+	err := e.RunOptions.retry(log.WithField("envscript", e.Cmd), func() error {
+		var err error
+		buf, err = e.output()
+		failed = err != nil
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	if failed {
+		return map[string]interface{}{}, nil
+	}
+
 	var f interface{}
 
 	err = yaml.Unmarshal(buf, &f)
@@ -34,15 +66,49 @@ func (e Script) Load() (map[string]string, error) {
 		return nil, err
 	}
 
+	return f, nil
+}
+
+// flatten flattens the parsed output of the script.
+func (e Script) flatten(f interface{}) (map[string]string, error) {
 	env := &FlatEnv{
-		Path: e.Dir,
-		Env:  make(map[string]string),
+		Path:    e.Dir,
+		Env:     make(map[string]string),
+		Options: e.Options,
 	}
 
-	err = env.Load(f, []string{})
+	err := env.Flatten(f)
 	if err != nil {
 		return nil, err
 	}
 
 	return env.Env, nil
 }
+
+// output runs the script once and returns its stdout.
+func (e Script) output() ([]byte, error) {
+	args := e.Args
+	if len(args) == 0 {
+		args = Command{Line: e.Cmd}.Args(nil)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = e.Dir
+	cmd.Env = e.Env
+	e.RunOptions.prepare(cmd)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	killed := e.RunOptions.killAfter(cmd)
+
+	err = e.RunOptions.wait(cmd, killed)
+	if err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Redacted replaces secret values in output.
+const Redacted = "******"
+
+// minSecretLength is the shortest secret value that is scrubbed from
+// free text such as log messages. Shorter values would mangle
+// unrelated output.
+const minSecretLength = 4
+
+// MarkSecret marks a key as secret.
+func (c *Config) MarkSecret(k string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.markSecret(k)
+}
+
+func (c *Config) markSecret(k string) {
+	if c.secrets == nil {
+		c.secrets = make(map[string]bool)
+	}
+	c.secrets[k] = true
+}
+
+// AddSecretPattern marks every key matching the pattern as secret. The
+// pattern uses the syntax of path.Match such as "*_TOKEN".
+func (c *Config) AddSecretPattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bad secret pattern %q: %s", pattern, err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.secretPatterns = append(c.secretPatterns, pattern)
+	return nil
+}
+
+// IsSecret reports if the key has been marked as secret.
+func (c *Config) IsSecret(k string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.isSecret(k)
+}
+
+func (c *Config) isSecret(k string) bool {
+	if c.secrets[k] {
+		return true
+	}
+
+	for _, pattern := range c.secretPatterns {
+		if ok, _ := path.Match(pattern, k); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Redact returns the value of a key for output, hiding it if the key
+// is secret.
+func (c *Config) Redact(k, v string) string {
+	if v != "" && c.IsSecret(k) {
+		return Redacted
+	}
+	return v
+}
+
+// RedactString hides any secret values found in s.
+func (c *Config) RedactString(s string) string {
+	values := c.secretValues()
+	if len(values) == 0 {
+		return s
+	}
+
+	pairs := make([]string, 0, len(values)*2)
+	for _, v := range values {
+		pairs = append(pairs, v, Redacted)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// RedactedEnv is the same as ToEnv with the secret values hidden.
+func (c *Config) RedactedEnv() []string {
+	envlist := c.ToEnv()
+	for i, pair := range envlist {
+		parts := strings.SplitN(pair, "=", 2)
+		envlist[i] = fmt.Sprintf("%s=%s", parts[0], c.Redact(parts[0], parts[1]))
+	}
+	return envlist
+}
+
+// secretValues returns the current and previous values of the secret
+// keys, longest first so a secret containing another is hidden whole.
+func (c *Config) secretValues() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	seen := make(map[string]bool)
+	values := []string{}
+
+	add := func(v string) {
+		if len(v) >= minSecretLength && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+
+	for k, v := range c.Data {
+		if !c.isSecret(k) {
+			continue
+		}
+
+		add(v)
+		for _, src := range c.History[k] {
+			add(src.Value)
+		}
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	return values
+}
+
+// RedactHook is a logrus hook that hides secret values in log
+// messages and fields.
+type RedactHook struct {
+	Config *Config
+}
+
+// NewRedactHook creates a hook to hide the secrets of the config.
+func NewRedactHook(c *Config) *RedactHook {
+	return &RedactHook{Config: c}
+}
+
+// Levels returns all levels so every entry is redacted.
+func (h *RedactHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire hides the secrets in the entry before it is written.
+func (h *RedactHook) Fire(entry *log.Entry) error {
+	entry.Message = h.Config.RedactString(entry.Message)
+
+	for k, v := range entry.Data {
+		switch vv := v.(type) {
+		case string:
+			entry.Data[k] = h.Config.RedactString(vv)
+		case error:
+			entry.Data[k] = errors.New(h.Config.RedactString(vv.Error()))
+		case fmt.Stringer:
+			entry.Data[k] = h.Config.RedactString(vv.String())
+		}
+	}
+
+	return nil
+}
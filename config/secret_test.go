@@ -0,0 +1,74 @@
+package config_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ionrock/xenv/config"
+)
+
+func secretEnvironment(t *testing.T) *config.Environment {
+	e, err := config.NewEnvironmentFromConfig("testdata/secrets.yml")
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	return e
+}
+
+func TestSecrets(t *testing.T) {
+	e := secretEnvironment(t)
+
+	secrets := map[string]bool{
+		"API_TOKEN":   true,
+		"DB_PASSWORD": true,
+		"USER":        false,
+	}
+
+	for k, secret := range secrets {
+		if e.Config.IsSecret(k) != secret {
+			t.Errorf("wrong secret for %s: %t", k, !secret)
+		}
+	}
+
+	// The real values are still used.
+	if v, _ := e.Config.Get("DB_PASSWORD"); v != "password-value" {
+		t.Errorf("wrong value for secret: %q", v)
+	}
+
+	env := strings.Join(e.Config.RedactedEnv(), "\n")
+	expected := "API_TOKEN=******\nDB_PASSWORD=******\nUSER=admin"
+	if env != expected {
+		t.Errorf("wrong redacted env: %q != %q", env, expected)
+	}
+}
+
+func TestRedactHook(t *testing.T) {
+	e := secretEnvironment(t)
+
+	var b bytes.Buffer
+	logger := log.New()
+	logger.Out = &b
+	logger.Hooks.Add(config.NewRedactHook(e.Config))
+
+	logger.WithFields(log.Fields{
+		"value": "token-value",
+		"error": errors.New("bad password: password-value"),
+	}).Info("using token-value")
+
+	if strings.Contains(b.String(), "-value") {
+		t.Errorf("secret found in log output: %s", b.String())
+	}
+
+	if !strings.Contains(b.String(), config.Redacted) {
+		t.Errorf("secret not redacted in log output: %s", b.String())
+	}
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ionrock/xenv/util"
+)
+
+// Shell is the program and arguments that run a command line, such as
+// "/bin/sh -c". The command line is added as the last argument. It
+// can be a string or a list.
+type Shell []string
+
+// UnmarshalJSON allows a Shell to be a string split on spaces.
+func (s *Shell) UnmarshalJSON(b []byte) error {
+	var line string
+	if err := json.Unmarshal(b, &line); err == nil {
+		*s = strings.Fields(line)
+		return nil
+	}
+
+	var args []string
+	err := json.Unmarshal(b, &args)
+	if err != nil {
+		return fmt.Errorf("invalid shell: %s", b)
+	}
+	*s = args
+	return nil
+}
+
+func (s Shell) String() string {
+	return strings.Join(s, " ")
+}
+
+// Command is a command line run with a shell or, when it is a list in
+// the config, a program and its arguments run without one.
+type Command struct {
+	// Line is the command line to run with a shell.
+	Line string
+
+	// Exec is the program and its arguments.
+	Exec []string
+}
+
+// UnmarshalJSON reads a Command from a string or a list.
+func (c *Command) UnmarshalJSON(b []byte) error {
+	var line string
+	if err := json.Unmarshal(b, &line); err == nil {
+		*c = Command{Line: line}
+		return nil
+	}
+
+	var args []string
+	err := json.Unmarshal(b, &args)
+	if err != nil {
+		return fmt.Errorf("invalid command: %s", b)
+	}
+	if len(args) == 0 {
+		return errors.New("command list is empty")
+	}
+	*c = Command{Exec: args}
+	return nil
+}
+
+func (c Command) String() string {
+	if c.Exec != nil {
+		return strings.Join(c.Exec, " ")
+	}
+	return c.Line
+}
+
+// Args returns the program and arguments to run the command. A
+// command line is run with the shell or the default shell when it is
+// empty.
+func (c Command) Args(shell Shell) []string {
+	if c.Exec != nil {
+		return c.Exec
+	}
+
+	if len(shell) == 0 {
+		shell = util.DefaultShell()
+	}
+	return append(append([]string{}, shell...), c.Line)
+}
+
+// expand expands the variables in the arguments of a command list.
+// A command line is left for the shell to expand.
+func (c Command) expand(mapping func(string) string) Command {
+	if c.Exec == nil {
+		return c
+	}
+
+	args := make([]string, len(c.Exec))
+	for i, arg := range c.Exec {
+		args[i] = os.Expand(arg, mapping)
+	}
+	return Command{Exec: args}
+}
+
+// shellFor returns the shell of a step, falling back to the shell set
+// for the config.
+func (e *Environment) shellFor(shell Shell) Shell {
+	if len(shell) > 0 {
+		return shell
+	}
+	return e.shell
+}
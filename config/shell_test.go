@@ -0,0 +1,130 @@
+package config_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ionrock/xenv/config"
+)
+
+func TestShellAndCommandForms(t *testing.T) {
+	tests := []struct {
+		in       string
+		shell    config.Shell
+		expected []string
+	}{
+		{`"/bin/sh -c"`, nil, []string{"/bin/sh", "-c", "echo hi"}},
+		{`["pwsh", "-Command"]`, nil, []string{"pwsh", "-Command", "echo hi"}},
+	}
+
+	for _, tc := range tests {
+		var shell config.Shell
+		err := json.Unmarshal([]byte(tc.in), &shell)
+		if err != nil {
+			t.Fatalf("error reading shell %s: %s", tc.in, err)
+		}
+
+		args := config.Command{Line: "echo hi"}.Args(shell)
+		if !reflect.DeepEqual(args, tc.expected) {
+			t.Errorf("wrong args for %s: %q", tc.in, args)
+		}
+	}
+
+	var cmd config.Command
+	err := json.Unmarshal([]byte(`["echo", "a b"]`), &cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := cmd.Args(config.Shell{"/bin/sh", "-c"}); !reflect.DeepEqual(args, []string{"echo", "a b"}) {
+		t.Errorf("expected the list to run without a shell: %q", args)
+	}
+
+	err = json.Unmarshal([]byte(`[]`), &cmd)
+	if err == nil {
+		t.Error("expected an error for an empty command list")
+	}
+}
+
+func TestShellSettings(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- env:
+    - BEFORE: '` + "`. ./shell.sh`" + `'
+- shell: /bin/sh -c
+- env:
+    - AFTER: '` + "`. ./shell.sh`" + `'
+- task:
+    cmd: echo $0 > global.txt
+- task:
+    cmd: echo $0 > step.txt
+    shell: [/bin/bash, -c]
+- envscript:
+    cmd: 'echo "SCRIPT: $0"'
+    shell: /bin/bash -c
+`,
+		// Values are expanded by xenv, so read $0 from a file.
+		"shell.sh": "echo $0\n",
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	for k, v := range map[string]string{"BEFORE": "/bin/bash", "AFTER": "/bin/sh", "SCRIPT": "/bin/bash"} {
+		if result, _ := e.Config.Get(k); result != v {
+			t.Errorf("wrong shell for %s: %q", k, result)
+		}
+	}
+
+	for name, v := range map[string]string{"global.txt": "/bin/sh\n", "step.txt": "/bin/bash\n"} {
+		if result := readFile(t, filepath.Join(dir, name)); result != v {
+			t.Errorf("wrong shell for %s: %q", name, result)
+		}
+	}
+}
+
+func TestExecFormCommands(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- env:
+    - NAME: "it's a $file; name"
+- task:
+    cmd: [touch, "$NAME"]
+- envscript:
+    cmd: [echo, "EXEC: $NAME"]
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	name := "it's a ; name"
+	if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+		t.Errorf("expected the task to run without a shell: %s", err)
+	}
+
+	if result, _ := e.Config.Get("EXEC"); result != name {
+		t.Errorf("wrong value: %q", result)
+	}
+}
+
+func TestExecFormInvalid(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": "---\n- task:\n    cmd: []\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := runPre(t, dir)
+	if err == nil || !strings.Contains(err.Error(), "command list is empty") {
+		t.Errorf("expected an error for the empty command, got %v", err)
+	}
+}
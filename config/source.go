@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// Kinds of Source.
+const (
+	SourceValue     = "value"
+	SourceCommand   = "command"
+	SourceEnvScript = "envscript"
+	SourceEnvFile   = "envfile"
+	SourceTask      = "task"
+	SourceOS        = "os"
+)
+
+// Source describes where a config value came from.
+type Source struct {
+	// File and Index are the file and position of the entry that set
+	// the value.
+	File  string
+	Index int
+
+	// Kind is how the value was produced and Command is the command
+	// or script that produced it.
+	Kind    string
+	Command string
+
+	Value string
+
+	// Secret marks the key as secret.
+	Secret bool
+}
+
+// Location describes the entry that set the value.
+func (s *Source) Location() string {
+	if s.Kind == SourceOS {
+		return "os environment"
+	}
+	return location(s.File, s.Index)
+}
+
+// Describe describes how the value was produced.
+func (s *Source) Describe() string {
+	if s.Command == "" {
+		return s.Kind
+	}
+	return fmt.Sprintf("%s %s", s.Kind, s.Command)
+}
+
+func (s *Source) String() string {
+	if s.Kind == SourceOS {
+		return fmt.Sprintf("%s: %q", s.Location(), s.Value)
+	}
+	return fmt.Sprintf("%s: %s: %q", s.Location(), s.Describe(), s.Value)
+}
+
+// location formats the position of an entry for messages.
+func location(file string, index int) string {
+	if file == "" {
+		return fmt.Sprintf("entry %d", index+1)
+	}
+	return fmt.Sprintf("%s: entry %d", file, index+1)
+}
+
+// Explain returns the sources of a key in the order they were set,
+// starting with the OS environment when the key is inherited. The last
+// source is the current value.
+func (c *Config) Explain(k string) []*Source {
+	sources := []*Source{}
+
+	if v, ok := os.LookupEnv(k); ok {
+		sources = append(sources, &Source{Kind: SourceOS, Value: v})
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append(sources, c.History[k]...)
+}
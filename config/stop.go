@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codeskyblue/kexec"
+)
+
+// DefaultStopGrace is how long the main command has to exit after
+// each signal before xenv escalates.
+const DefaultStopGrace = 10 * time.Second
+
+// forwardSignals are passed on to the process group of the main
+// command without stopping it.
+var forwardSignals = []syscall.Signal{
+	syscall.SIGHUP,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+	syscall.SIGQUIT,
+}
+
+// Stop configures how the main command is stopped.
+type Stop struct {
+	// Signal is sent to the process group of the command to stop
+	// it. The default is SIGINT.
+	Signal string `json:"signal"`
+
+	// Grace is how long the command has to exit before xenv sends
+	// SIGTERM and then SIGKILL. The default is 10s.
+	Grace *Duration `json:"grace"`
+}
+
+func (s *Stop) check() error {
+	if s.Signal == "" {
+		return nil
+	}
+	_, err := parseSignal(s.Signal)
+	return err
+}
+
+func (s *Stop) signal() syscall.Signal {
+	if s == nil || s.Signal == "" {
+		return syscall.SIGINT
+	}
+
+	sig, err := parseSignal(s.Signal)
+	if err != nil {
+		return syscall.SIGINT
+	}
+	return sig
+}
+
+func (s *Stop) grace() time.Duration {
+	if s == nil || s.Grace == nil {
+		return DefaultStopGrace
+	}
+	return s.Grace.Std()
+}
+
+// escalation returns the signals to send in order, starting with sig
+// and ending with SIGKILL.
+func escalation(sig syscall.Signal) []syscall.Signal {
+	signals := []syscall.Signal{sig}
+	if sig != syscall.SIGTERM && sig != syscall.SIGKILL {
+		signals = append(signals, syscall.SIGTERM)
+	}
+	if sig != syscall.SIGKILL {
+		signals = append(signals, syscall.SIGKILL)
+	}
+	return signals
+}
+
+// stop stops the main command by sending sig to its process group,
+// waiting on done for it to exit. When it is still running after the
+// grace period the signal is escalated to SIGTERM and then SIGKILL.
+// Anything left in the process group after the command exits is
+// killed. The result of the command is returned.
+func (e *Environment) stop(cmd *kexec.KCommand, done chan error, sig syscall.Signal) error {
+	// A command that didn't start has already sent its error.
+	if cmd.Process == nil {
+		return <-done
+	}
+
+	for _, s := range escalation(sig) {
+		log.WithField("signal", s).Info("Stopping command")
+
+		err := cmd.Terminate(s)
+		if err != nil {
+			log.WithError(err).Warn("error stopping process")
+		}
+
+		select {
+		case err := <-done:
+			killGroup(cmd)
+			return err
+		case <-time.After(e.stopSettings.grace()):
+			log.WithField("grace", e.stopSettings.grace()).Warn("command did not exit in time")
+		}
+	}
+
+	// The command couldn't be stopped, so don't wait forever.
+	return errors.New("command did not stop")
+}
+
+// signalGroup sends sig to the process group of the command, like the
+// signals that stop it, so a program run by a shell receives it too.
+func signalGroup(cmd *kexec.KCommand, sig syscall.Signal) error {
+	if cmd.Process == nil {
+		return errors.New("command is not running")
+	}
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+// killGroup kills any processes left in the process group of the
+// command.
+func killGroup(cmd *kexec.KCommand) {
+	if cmd.Process == nil {
+		return
+	}
+
+	pgid := cmd.Process.Pid
+	if syscall.Kill(-pgid, 0) != nil {
+		return
+	}
+
+	log.WithField("pgid", pgid).Warn("Killing processes left by command")
+	err := syscall.Kill(-pgid, syscall.SIGKILL)
+	if err != nil {
+		log.WithError(err).Warn("error killing process group")
+	}
+}
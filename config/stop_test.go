@@ -0,0 +1,153 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// running reports if the process is running and not a zombie.
+func running(pid int) bool {
+	b, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+
+	fields := strings.Fields(string(b))
+	return len(fields) > 2 && fields[2] != "Z"
+}
+
+func TestStopEscalatesToKill(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- watch:
+    interval: 0
+- stop:
+    signal: SIGINT
+    grace: 0.2
+- envfile: app.env
+`,
+		"app.env":   "FOO=bar\n",
+		"script.sh": "trap '' INT TERM\ntouch started\nwhile :; do sleep 0.05; done\n",
+	})
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+	err := runMain(t, dir, "exec sh script.sh", func() {
+		err := ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("FOO=baz\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err == nil || !strings.Contains(err.Error(), "killed") {
+		t.Errorf("expected the command to be killed, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expected the command to get a grace period for each signal, stopped in %s", elapsed)
+	}
+}
+
+func TestStopKillsProcessGroup(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- watch:
+    interval: 0
+- envfile: app.env
+`,
+		"app.env":  "FOO=bar\n",
+		"child.sh": "echo $$ > child.pid\ntrap '' INT\nwhile :; do sleep 0.05; done\n",
+		"script.sh": `sh child.sh &
+while [ ! -f child.pid ]; do sleep 0.05; done
+touch started
+trap 'exit 0' INT
+wait
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	err := runMain(t, dir, "exec sh script.sh", func() {
+		err := ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("FOO=baz\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("error running main: %s", err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(readFile(t, filepath.Join(dir, "child.pid"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 40 && running(pid); i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if running(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("process %d left by the command is still running", pid)
+	}
+}
+
+func TestForwardSignals(t *testing.T) {
+	// Make sure the test isn't stopped by the signal.
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGHUP)
+	defer signal.Stop(guard)
+
+	dir := writeFiles(t, map[string]string{
+		"xe.yml":    "---\n- watch:\n    disable: true\n",
+		"script.sh": "trap 'echo hup > hup.txt; exit 0' HUP\ntouch started\nwhile :; do sleep 0.05; done\n",
+	})
+	defer os.RemoveAll(dir)
+
+	err := runMain(t, dir, "exec sh script.sh", func() {
+		err := syscall.Kill(os.Getpid(), syscall.SIGHUP)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("error running main: %s", err)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "hup.txt")); result != "hup\n" {
+		t.Errorf("signal was not forwarded: %q", result)
+	}
+}
+
+func TestForwardSignalsToGroup(t *testing.T) {
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGHUP)
+	defer signal.Stop(guard)
+
+	// The shell keeps waiting for the script unless the script gets
+	// the signal too.
+	dir := writeFiles(t, map[string]string{
+		"xe.yml":    "---\n- watch:\n    disable: true\n",
+		"script.sh": "trap 'echo hup > hup.txt; exit 0' HUP\ntouch started\nwhile :; do sleep 0.05; done\n",
+	})
+	defer os.RemoveAll(dir)
+
+	err := runMain(t, dir, "trap true HUP; sh script.sh", func() {
+		err := syscall.Kill(os.Getpid(), syscall.SIGHUP)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("error running main: %s", err)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "hup.txt")); result != "hup\n" {
+		t.Errorf("signal was not forwarded to the group: %q", result)
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import "os"
+
+// SetData merges v into the structured data of the Config at the path.
+// Maps are merged with the maps already there and other values replace
+// what is there. Values that aren't maps are only kept with a path.
+func (c *Config) SetData(path []string, v interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i := len(path) - 1; i >= 0; i-- {
+		v = map[string]interface{}{path[i]: v}
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	c.structured = mergeData(c.structured, m)
+}
+
+// StructuredData returns the values of envfiles, envscripts and
+// registered task output before they were flattened. The data is
+// replaced rather than changed when values are set, so it must not be
+// modified.
+func (c *Config) StructuredData() map[string]interface{} {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.structured == nil {
+		return map[string]interface{}{}
+	}
+	return c.structured
+}
+
+// dataAt returns the structured data at the path or nil.
+func (c *Config) dataAt(path []string) interface{} {
+	var v interface{} = c.StructuredData()
+	for _, k := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+// mergeData returns a new map with the values of src merged into dst.
+// The maps are left as they are so readers of dst aren't affected.
+func mergeData(dst, src map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(dst)+len(src))
+	for k, v := range dst {
+		merged[k] = v
+	}
+
+	for k, v := range src {
+		sm, ok := v.(map[string]interface{})
+		dm, dok := merged[k].(map[string]interface{})
+		if ok && dok {
+			merged[k] = mergeData(dm, sm)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// expandData expands the variables in the strings of the structured
+// data like they are in the flattened values.
+func expandData(v interface{}, mapping func(string) string) interface{} {
+	switch vv := v.(type) {
+	case string:
+		return os.Expand(vv, mapping)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, x := range vv {
+			m[k] = expandData(x, mapping)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(vv))
+		for i, x := range vv {
+			l[i] = expandData(x, mapping)
+		}
+		return l
+	}
+	return v
+}
+
+// dataPath returns the path the structured data is kept at, which is
+// the prefix of the flattened keys.
+func dataPath(opts FlattenOptions, keys ...string) []string {
+	path := []string{}
+	if opts.Prefix != "" {
+		path = append(path, opts.Prefix)
+	}
+	return append(path, keys...)
+}
@@ -0,0 +1,116 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const upstreamTmpl = `upstream {{ .Data.name }} {
+{{- range .Data.APP.upstreams }}
+  server {{ .host }}:{{ .port }};
+{{- end }}
+}
+# {{ .Data.VERSIONS.latest }} {{ .Env.APP_region }} {{ .APP_region }}
+`
+
+func TestTemplateData(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app.json":      `{"region": "$REGION", "upstreams": [{"host": "a", "port": 80}, {"host": "b", "port": 81}]}`,
+		"upstream.tmpl": upstreamTmpl,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg := `---
+- env:
+    - REGION: east
+- envfile:
+    path: app.json
+    prefix: APP
+- envscript: "echo 'name: web'"
+- task:
+    cmd: "echo '{\"latest\": \"1.2\"}'"
+    register: VERSIONS
+    parse: json
+- template:
+    template: upstream.tmpl
+    target: ` + filepath.Join(dir, "upstream.conf") + `
+`
+	err := ioutil.WriteFile(filepath.Join(dir, "xe.yml"), []byte(cfg), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	expected := `upstream web {
+  server a:80;
+  server b:81;
+}
+# 1.2 east east
+`
+	if result := readFile(t, filepath.Join(dir, "upstream.conf")); result != expected {
+		t.Errorf("wrong content: %q", result)
+	}
+
+	data := e.Config.StructuredData()
+	if app, ok := data["APP"].(map[string]interface{}); !ok || app["region"] != "east" {
+		t.Errorf("expected the envfile data to be expanded: %v", data["APP"])
+	}
+}
+
+func TestTemplateDataReload(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app.json":      `{"region": "east", "upstreams": [{"host": "a", "port": 80}]}`,
+		"upstream.tmpl": upstreamTmpl,
+	})
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "upstream.conf")
+	cfg := `---
+- watch:
+    interval: 0
+- envfile:
+    path: app.json
+    prefix: APP
+- envscript: "echo 'name: web'"
+- task:
+    cmd: "echo '{\"latest\": \"1.2\"}'"
+    register: VERSIONS
+    parse: json
+- template:
+    template: upstream.tmpl
+    target: ` + target + `
+    on_change:
+      signal: SIGHUP
+`
+	err := ioutil.WriteFile(filepath.Join(dir, "xe.yml"), []byte(cfg), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = runMain(t, dir, `touch started; trap "exit 0" HUP; while :; do sleep 0.05; done`, func() {
+		err := ioutil.WriteFile(filepath.Join(dir, "app.json"), []byte(`{"region": "west", "upstreams": [{"host": "a", "port": 80}, {"host": "c", "port": 82}]}`), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("error running main: %s", err)
+	}
+
+	// The task doesn't run again, but its data is kept.
+	expected := `upstream web {
+  server a:80;
+  server c:82;
+}
+# 1.2 west west
+`
+	if result := readFile(t, target); result != expected {
+		t.Errorf("wrong content: %q", result)
+	}
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"bytes"
 	"os/exec"
 	"sync"
+	"syscall"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/ionrock/xenv/util"
@@ -16,29 +18,84 @@ type Task struct {
 	// Cmd is the command to execute. This will be run in a sh.
 	Cmd string
 
+	// Args are the program and its arguments to run instead. When
+	// they are empty the Cmd is run with util.DefaultShell().
+	Args []string
+
 	// Dir is the directory to run the command.
 	Dir string
 
 	// Env is the environment to use for the command.
 	Env []string
 
+	// Credential runs the command as another user and group.
+	Credential *syscall.Credential
+
+	// RunOptions set the timeout and retries of the command.
+	RunOptions RunOptions
+
+	// Output receives the stdout of the last attempt when it is set.
+	// It is empty when the command failed.
+	Output *bytes.Buffer
+
+	// Failed is set by Run when the last attempt failed, even when its
+	// errors are ignored.
+	Failed bool
+
 	StdoutHandler util.OutHandler
 	StderrHandler util.OutHandler
 }
 
 // Run runs the command and prints the output to stdout prefixed by the Name.
+// A failed command is retried according to the RunOptions.
 func (t *Task) Run() error {
-	cmd := exec.Command("/bin/bash", "-c", t.Cmd)
-	cmd.Dir = t.Dir
-	cmd.Env = t.Env
+	taskLog := t.log()
 
+	taskLog.Info("Running Task")
+
+	outhandler := func(line string) string {
+		taskLog.Info(line)
+		return line
+	}
+
+	// These close the stdout/err channels
+	if t.StdoutHandler == nil {
+		t.StdoutHandler = outhandler
+	}
+
+	if t.StderrHandler == nil {
+		t.StderrHandler = outhandler
+	}
+
+	return t.RunOptions.retry(taskLog, func() error {
+		err := t.run()
+		t.Failed = err != nil
+		return err
+	})
+}
+
+// log returns the logger of the task, named by its name or command.
+func (t *Task) log() *log.Entry {
 	name := t.Name
 	if name == "" {
 		name = t.Cmd
 	}
-	taskLog := log.WithFields(log.Fields{"name": name})
+	return log.WithFields(log.Fields{"name": name})
+}
 
-	taskLog.Info("Running Task")
+func (t *Task) run() error {
+	args := t.Args
+	if len(args) == 0 {
+		args = Command{Line: t.Cmd}.Args(nil)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = t.Dir
+	cmd.Env = t.Env
+	if t.Credential != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: t.Credential}
+	}
+	t.RunOptions.prepare(cmd)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -52,31 +109,32 @@ func (t *Task) Run() error {
 		return err
 	}
 
-	wg := new(sync.WaitGroup)
-	wg.Add(2)
-
-	outhandler := func(line string) string {
-		taskLog.Info(line)
-		return line
+	stdoutHandler := t.StdoutHandler
+	if t.Output != nil {
+		t.Output.Reset()
+		stdoutHandler = func(line string) string {
+			t.Output.WriteString(line + "\n")
+			return t.StdoutHandler(line)
+		}
 	}
 
-	// These close the stdout/err channels
-	if t.StdoutHandler == nil {
-		t.StdoutHandler = outhandler
-	}
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
 
-	if t.StderrHandler == nil {
-		t.StderrHandler = outhandler
-	}
-	go util.LineReader(wg, stdout, t.StdoutHandler)
+	go util.LineReader(wg, stdout, stdoutHandler)
 	go util.LineReader(wg, stderr, t.StderrHandler)
 
 	err = cmd.Start()
 	if err != nil {
 		return err
 	}
+	killed := t.RunOptions.killAfter(cmd)
 
 	wg.Wait()
 
-	return cmd.Wait()
+	err = t.RunOptions.wait(cmd, killed)
+	if err != nil && t.Output != nil {
+		t.Output.Reset()
+	}
+	return err
 }
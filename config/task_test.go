@@ -0,0 +1,97 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTaskEnv(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- env:
+    - HOST: db
+    - PORT: "5432"
+- task:
+    cmd: echo $URL $PORT > inherit.txt
+    env:
+      URL: postgres://$HOST:$PORT
+      PORT: "6543"
+- task:
+    cmd: env > isolated.txt
+    inherit_env: false
+    env:
+      URL: postgres://$HOST
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	e, err := runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	if result := readFile(t, filepath.Join(dir, "inherit.txt")); result != "postgres://db:5432 6543\n" {
+		t.Errorf("wrong task env: %q", result)
+	}
+
+	isolated := readFile(t, filepath.Join(dir, "isolated.txt"))
+	if !strings.Contains(isolated, "URL=postgres://db\n") {
+		t.Errorf("expected the task value: %q", isolated)
+	}
+	if strings.Contains(isolated, "HOST=") {
+		t.Errorf("expected the config to be left out: %q", isolated)
+	}
+
+	if _, ok := e.Config.Get("URL"); ok {
+		t.Error("task value leaked into the config")
+	}
+	if result, _ := e.Config.Get("PORT"); result != "5432" {
+		t.Errorf("task value replaced the config: %q", result)
+	}
+}
+
+func TestTaskUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("running as another user needs root")
+	}
+
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": `---
+- task:
+    cmd: id -u > uid.txt; id -g > gid.txt
+    user: nobody
+    group: "65534"
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	err := os.Chmod(dir, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = runPre(t, dir)
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	for name, v := range map[string]string{"uid.txt": "65534\n", "gid.txt": "65534\n"} {
+		if result := readFile(t, filepath.Join(dir, name)); result != v {
+			t.Errorf("wrong %s: %q", name, result)
+		}
+	}
+}
+
+func TestTaskUnknownUser(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"xe.yml": "---\n- task:\n    cmd: \"true\"\n    user: no-such-user-xenv\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := runPre(t, dir)
+	if err == nil || !strings.Contains(err.Error(), "no-such-user-xenv") {
+		t.Errorf("expected an error for the unknown user, got %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// actionKeys are the keys of an entry that define what it does. An
+// entry must have exactly one of them.
+var actionKeys = []string{
+	"service",
+	"env",
+	"envscript",
+	"envfile",
+	"task",
+	"post",
+	"template",
+	"include",
+	"secrets",
+	"watch",
+	"on_change",
+	"stop",
+	"shell",
+	"inherit",
+}
+
+var (
+	xeConfigType    = reflect.TypeOf(XeConfig{})
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// ValidationError is a problem found in a config file.
+type ValidationError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+}
+
+// ValidationErrors are all the problems found in a config file.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+type validator struct {
+	file string
+	errs ValidationErrors
+}
+
+func (v *validator) errorf(node *yaml.Node, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{
+		File:   v.file,
+		Line:   node.Line,
+		Column: node.Column,
+		Msg:    fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate checks the contents of a config file against the fields of
+// XeConfig. Unknown keys, values of the wrong kind and entries that
+// don't have exactly one action are reported with their position in
+// the file.
+func Validate(file string, b []byte) error {
+	var doc yaml.Node
+	err := yaml.Unmarshal(b, &doc)
+	if err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+
+	// An empty file has no entries.
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	v := &validator{file: file}
+	v.check(doc.Content[0], reflect.TypeOf([]*XeConfig{}))
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+func (v *validator) check(node *yaml.Node, t reflect.Type) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	// A null value leaves the field empty.
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Types that parse themselves may accept more than one form, so
+	// only check the forms we know about.
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		switch {
+		case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+			v.checkStruct(node, t)
+		case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+			v.checkSlice(node, t)
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		v.checkStruct(node, t)
+	case reflect.Slice:
+		v.checkSlice(node, t)
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.errorf(node, "expected a map")
+			return
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			v.check(node.Content[i], t.Elem())
+		}
+	case reflect.Interface:
+	default:
+		if node.Kind != yaml.ScalarNode {
+			v.errorf(node, "expected a single value")
+		}
+	}
+}
+
+func (v *validator) checkSlice(node *yaml.Node, t reflect.Type) {
+	if node.Kind != yaml.SequenceNode {
+		v.errorf(node, "expected a list")
+		return
+	}
+
+	for _, item := range node.Content {
+		v.check(item, t.Elem())
+	}
+}
+
+func (v *validator) checkStruct(node *yaml.Node, t reflect.Type) {
+	if node.Kind != yaml.MappingNode {
+		v.errorf(node, "expected a map")
+		return
+	}
+
+	fields := jsonFields(t)
+	actions := []string{}
+	keys := []*yaml.Node{}
+
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		keys = append(keys, key)
+
+		ft, ok := fields[key.Value]
+		if !ok {
+			msg := fmt.Sprintf("unknown key %q", key.Value)
+			if guess := closest(key.Value, fields); guess != "" {
+				msg = fmt.Sprintf("%s, did you mean %q?", msg, guess)
+			}
+			v.errorf(key, "%s", msg)
+			continue
+		}
+
+		if t == xeConfigType && isAction(key.Value) {
+			actions = append(actions, key.Value)
+		}
+
+		v.check(value, ft)
+	}
+
+	if t != xeConfigType {
+		return
+	}
+
+	switch len(actions) {
+	case 0:
+		v.errorf(node, "entry has no action, expected one of: %s", strings.Join(actionKeys, ", "))
+	case 1:
+		v.checkOptions(actions[0], keys)
+	default:
+		v.errorf(node, "entry has more than one action: %s", strings.Join(actions, ", "))
+	}
+}
+
+// includeKeys are the keys an include entry accepts. Other options
+// would apply to the entry itself rather than to the included entries.
+var includeKeys = []string{"include", "when", "secret"}
+
+// runOptionActions are the entries the timeout and retry keys apply to.
+var runOptionActions = []string{"env", "envscript", "task"}
+
+// checkOptions reports the keys of an entry that don't apply to its
+// action.
+func (v *validator) checkOptions(action string, keys []*yaml.Node) {
+	runOptions := jsonFields(reflect.TypeOf(RunOptions{}))
+
+	for _, key := range keys {
+		_, isRunOption := runOptions[key.Value]
+
+		switch {
+		case action == "include" && !contains(includeKeys, key.Value):
+			v.errorf(key, "%q can't be used with include, only %s", key.Value, strings.Join(includeKeys[1:], " and "))
+		case isRunOption && !contains(runOptionActions, action):
+			v.errorf(key, "%q only applies to %s entries", key.Value, strings.Join(runOptionActions, ", "))
+		}
+	}
+}
+
+func isAction(key string) bool {
+	return contains(actionKeys, key)
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonFields maps the keys a struct accepts using its json tags to the
+// types of the fields, including the fields of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			for k, ft := range jsonFields(f.Type) {
+				fields[k] = ft
+			}
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if tag == "" {
+			tag = f.Name
+		}
+		fields[tag] = f.Type
+	}
+
+	return fields
+}
+
+// closest finds a key that is only a couple of edits away from the
+// unknown key.
+func closest(key string, fields map[string]reflect.Type) string {
+	best := ""
+	bestDist := 3
+	for k := range fields {
+		d := editDistance(key, k)
+		if d < bestDist || (d == bestDist && best != "" && k < best) {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
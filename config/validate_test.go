@@ -0,0 +1,72 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ionrock/xenv/config"
+)
+
+func TestValidate(t *testing.T) {
+	paths := []string{
+		"../examples/config.yml",
+		"testdata/when.yml",
+	}
+
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("error reading %s: %s", path, err)
+		}
+
+		err = config.Validate(path, b)
+		if err != nil {
+			t.Errorf("unexpected error validating %s: %s", path, err)
+		}
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	path := "testdata/invalid.yml"
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading %s: %s", path, err)
+	}
+
+	err = config.Validate(path, b)
+	if err == nil {
+		t.Fatalf("expected errors validating %s", path)
+	}
+
+	errs, ok := err.(config.ValidationErrors)
+	if !ok {
+		t.Fatalf("wrong error type: %#v", err)
+	}
+
+	expected := []string{
+		`testdata/invalid.yml:5:3: unknown key "tempalte", did you mean "template"?`,
+		`testdata/invalid.yml:5:3: entry has no action`,
+		`testdata/invalid.yml:9:3: entry has more than one action: task, env`,
+		`testdata/invalid.yml:17:5: unknown key "cdm", did you mean "cmd"?`,
+		`testdata/invalid.yml:20:3: "refresh" can't be used with include, only when and secret`,
+		`testdata/invalid.yml:25:3: "timeout" only applies to env, envscript, task entries`,
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("wrong number of errors: %s", err)
+	}
+
+	for i := range expected {
+		if !strings.HasPrefix(errs[i].Error(), expected[i]) {
+			t.Errorf("wrong error: %q != %q", errs[i], expected[i])
+		}
+	}
+}
+
+func TestNewXeConfigRejectsInvalid(t *testing.T) {
+	_, err := config.NewXeConfig("testdata/invalid.yml")
+	if err == nil {
+		t.Errorf("expected an error loading an invalid config")
+	}
+}
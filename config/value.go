@@ -17,9 +17,15 @@ import (
 // value. For example, if a command normally would output an extra new
 // line for the terminal, that newline is removed.
 func CompileValue(value, path string, env []string) (string, error) {
+	return compileValue(value, path, env, nil, RunOptions{})
+}
+
+// compileValue is CompileValue with a shell, and a timeout and retries
+// for the command. When its errors are ignored the value is empty.
+func compileValue(value, path string, env []string, shell Shell, opts RunOptions) (string, error) {
 	logCtx := log.WithFields(log.Fields{"value": value})
 
-	if !strings.HasPrefix(value, "`") || !strings.HasSuffix(value, "`") {
+	if !isCommand(value) {
 		return value, nil
 	}
 
@@ -28,18 +34,39 @@ func CompileValue(value, path string, env []string) (string, error) {
 		return "", err
 	}
 
-	cmd := exec.Command("/bin/bash", "-c", strings.Trim(value, "`"))
-	cmd.Dir = dirname
-	if len(env) > 0 {
-		cmd.Env = env
-	}
-
 	logCtx.Debug("executing value")
 
-	buf, err := cmd.Output()
+	args := Command{Line: strings.Trim(value, "`")}.Args(shell)
+
+	var buf bytes.Buffer
+	err = opts.retry(logCtx, func() error {
+		buf.Reset()
+
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = dirname
+		if len(env) > 0 {
+			cmd.Env = env
+		}
+		cmd.Stdout = &buf
+		opts.prepare(cmd)
+
+		err := cmd.Start()
+		if err == nil {
+			err = opts.wait(cmd, opts.killAfter(cmd))
+		}
+		if err != nil {
+			buf.Reset()
+		}
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
 
-	return string(bytes.TrimSpace(buf)), nil
+	return string(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+// isCommand reports if the value is a command in backticks.
+func isCommand(value string) bool {
+	return len(value) > 1 && strings.HasPrefix(value, "`") && strings.HasSuffix(value, "`")
 }
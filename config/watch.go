@@ -0,0 +1,379 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fsnotify/fsnotify"
+	"github.com/ionrock/xenv/templates"
+)
+
+// DefaultWatchInterval is how often the whole config is rebuilt to
+// look for changes when the interval isn't set.
+const DefaultWatchInterval = 10 * time.Second
+
+// Watch configures how xenv looks for changes while the command runs.
+type Watch struct {
+	// Interval is how often the whole config is rebuilt to look for
+	// changes. The default is 10s and 0 turns it off.
+	Interval *Duration `json:"interval"`
+
+	// Jitter adds a random delay up to the jitter to each interval,
+	// so many instances don't all poll at once.
+	Jitter Duration `json:"jitter"`
+
+	// Files watches envfiles and templates for changes. The default
+	// is true.
+	Files *bool `json:"files"`
+
+	// Disable turns off looking for changes.
+	Disable bool `json:"disable"`
+}
+
+func (w *Watch) interval() time.Duration {
+	if w == nil || w.Interval == nil {
+		return DefaultWatchInterval
+	}
+	return w.Interval.Std()
+}
+
+func (w *Watch) jitter() time.Duration {
+	if w == nil {
+		return 0
+	}
+	return w.Jitter.Std()
+}
+
+func (w *Watch) files() bool {
+	return w == nil || w.Files == nil || *w.Files
+}
+
+func (w *Watch) disabled() bool {
+	return w != nil && w.Disable
+}
+
+// Watcher looks for changes to a source of the environment. Watch
+// sends on events each time it finds a change until stop is closed.
+type Watcher interface {
+	Watch(events chan<- struct{}, stop <-chan struct{}) error
+}
+
+// CheckFunc reports if a source has changed.
+type CheckFunc func() (bool, error)
+
+// PollWatcher calls Check on an interval.
+type PollWatcher struct {
+	Interval time.Duration
+
+	// Jitter adds a random delay up to the jitter to each interval.
+	Jitter time.Duration
+
+	Check CheckFunc
+}
+
+// Watch polls until stop is closed.
+func (w *PollWatcher) Watch(events chan<- struct{}, stop <-chan struct{}) error {
+	go func() {
+		for {
+			timer := time.NewTimer(w.next())
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if check(w.Check) {
+				notify(events, stop)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (w *PollWatcher) next() time.Duration {
+	if w.Jitter <= 0 {
+		return w.Interval
+	}
+	return w.Interval + time.Duration(rand.Int63n(int64(w.Jitter)))
+}
+
+// FileWatcher calls Check when one of the files is written, created,
+// renamed or removed. The directories of the files are watched so
+// files that are replaced by renaming are still seen.
+type FileWatcher struct {
+	Paths []string
+	Check CheckFunc
+}
+
+// Watch starts watching the files until stop is closed.
+func (w *FileWatcher) Watch(events chan<- struct{}, stop <-chan struct{}) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	paths := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, path := range w.Paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			fw.Close()
+			return err
+		}
+		paths[abs] = true
+
+		dir := filepath.Dir(abs)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+
+		err = fw.Add(dir)
+		if err != nil {
+			fw.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer fw.Close()
+		for {
+			select {
+			case <-stop:
+				return
+			case err := <-fw.Errors:
+				log.WithError(err).Warn("error watching files")
+			case ev := <-fw.Events:
+				if !paths[ev.Name] || ev.Op == fsnotify.Chmod {
+					continue
+				}
+				log.WithField("file", ev.Name).Debug("file changed")
+
+				if check(w.Check) {
+					notify(events, stop)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Watchers returns the watchers for the environment based on the watch
+// setting. The whole config is rebuilt on the watch interval, entries
+// with a refresh are run again on their own interval and envfiles and
+// templates are checked when their files change.
+func (e *Environment) Watchers() []Watcher {
+	if e.watch.disabled() {
+		return nil
+	}
+
+	watchers := []Watcher{}
+	if interval := e.watch.interval(); interval > 0 {
+		watchers = append(watchers, &PollWatcher{
+			Interval: interval,
+			Jitter:   e.watch.jitter(),
+			Check:    e.rlocked(e.configChanged),
+		})
+	}
+
+	for _, cfg := range e.watched {
+		cfg := cfg
+		dir := e.entryDir(cfg)
+		entryChanged := e.rlocked(func() (bool, error) { return e.entryChanged(cfg) })
+
+		if cfg.Refresh > 0 {
+			watchers = append(watchers, &PollWatcher{
+				Interval: cfg.Refresh.Std(),
+				Jitter:   e.watch.jitter(),
+				Check:    entryChanged,
+			})
+		}
+
+		if !e.watch.files() {
+			continue
+		}
+
+		switch {
+		case cfg.EnvFile != nil:
+			watchers = append(watchers, &FileWatcher{
+				Paths: []string{cfg.EnvFile.path(dir)},
+				Check: entryChanged,
+			})
+
+		case cfg.Template != nil:
+			// Files added to a source_dir later aren't watched.
+			paths, err := cfg.Template.Sources(dir)
+			if err != nil {
+				log.WithError(err).Warn("error watching template")
+				continue
+			}
+			if len(paths) == 0 {
+				continue
+			}
+
+			watchers = append(watchers, &FileWatcher{
+				Paths: paths,
+				Check: e.rlocked(func() (bool, error) { return templateChanged(cfg.Template, dir) }),
+			})
+		}
+	}
+
+	return watchers
+}
+
+// rlocked returns a CheckFunc that holds a read lock on the
+// environment while it runs.
+func (e *Environment) rlocked(fn CheckFunc) CheckFunc {
+	return func() (bool, error) {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		return fn()
+	}
+}
+
+// startWatchers starts the watchers sending on events until stop is
+// closed.
+func (e *Environment) startWatchers(events chan<- struct{}, stop <-chan struct{}) {
+	for _, w := range e.Watchers() {
+		err := w.Watch(events, stop)
+		if err != nil {
+			log.WithError(err).Warn("error starting watcher")
+		}
+	}
+}
+
+// configChanged rebuilds the whole config and reports if any values
+// have changed.
+func (e *Environment) configChanged() (bool, error) {
+	ne, err := NewEnvironmentFromConfig(e.ConfigFile)
+	if err != nil {
+		return false, err
+	}
+
+	ne.DataOnly = true
+	ne.previous = e.Config
+	err = ne.Pre()
+	if err != nil {
+		return false, err
+	}
+
+	return e.changed(ne.Config), nil
+}
+
+// changed reports if the values of the other config are different,
+// leaving out the keys with ignored changes.
+func (e *Environment) changed(o *Config) bool {
+	diff := e.Config.Diff(o)
+	if diff == nil {
+		return false
+	}
+
+	fields := log.Fields{}
+	for k, v := range diff.Data {
+		if !e.ignored(k) {
+			fields[k] = o.Redact(k, v)
+		}
+	}
+	if len(fields) == 0 {
+		return false
+	}
+	log.WithFields(fields).Debug("env diff")
+
+	return true
+}
+
+// entryChanged runs the entry again using a copy of the config and
+// reports if any of the values it set have changed. Values that a
+// later entry has overridden are ignored.
+func (e *Environment) entryChanged(cfg *XeConfig) (bool, error) {
+	ne := NewEnvironment()
+	ne.ConfigDir = e.ConfigDir
+	ne.ConfigFile = e.ConfigFile
+	ne.DataOnly = true
+	ne.Config = e.Config.Copy()
+	ne.shell = e.shell
+	ne.inherit = e.inherit
+
+	err := ne.ConfigHandler(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	for k := range ne.Config.History {
+		history := e.Config.History[k]
+		if len(history) == 0 {
+			continue
+		}
+
+		last := history[len(history)-1]
+		if last.File != cfg.file || last.Index != cfg.index || e.ignored(k) {
+			continue
+		}
+
+		if ne.Config.Data[k] != e.Config.Data[k] {
+			log.WithFields(log.Fields{
+				"entry": cfg.Location(),
+				"key":   k,
+			}).Debug("entry changed")
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// templateChanged renders the templates and reports if any result is
+// different from its target.
+func templateChanged(tmpl *templates.Renderer, dir string) (bool, error) {
+	files, err := tmpl.Files(dir)
+	if err != nil {
+		return false, err
+	}
+
+	for _, f := range files {
+		rendered, err := tmpl.RenderFile(dir, f)
+		if err != nil {
+			return false, err
+		}
+
+		current, err := ioutil.ReadFile(f.Target)
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if !bytes.Equal(current, rendered) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// check calls the CheckFunc, logging any error as no change.
+func check(fn CheckFunc) bool {
+	changed, err := fn()
+	if err != nil {
+		log.WithError(err).Warn("error looking for changes")
+		return false
+	}
+	return changed
+}
+
+// notify sends an event unless the watcher has been stopped.
+func notify(events chan<- struct{}, stop <-chan struct{}) {
+	select {
+	case events <- struct{}{}:
+	case <-stop:
+	}
+}
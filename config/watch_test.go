@@ -0,0 +1,166 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ionrock/xenv/config"
+)
+
+func waitForEvent(t *testing.T, events chan struct{}) {
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a change event")
+	}
+}
+
+func TestPollWatcher(t *testing.T) {
+	calls := 0
+	w := &config.PollWatcher{
+		Interval: 10 * time.Millisecond,
+		Jitter:   5 * time.Millisecond,
+		Check: func() (bool, error) {
+			calls++
+			return calls == 3, nil
+		},
+	}
+
+	events := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+
+	err := w.Watch(events, stop)
+	if err != nil {
+		t.Fatalf("error starting watcher: %s", err)
+	}
+
+	waitForEvent(t, events)
+}
+
+func TestWatchersFromSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xenv-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := `---
+- watch:
+    interval: 0
+- envfile: app.env
+- env:
+    - NOW: '` + "`date +%s%N`" + `'
+  refresh: 1m
+`
+	err = ioutil.WriteFile(filepath.Join(dir, "xe.yml"), []byte(cfg), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("FOO=bar\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := config.NewEnvironmentFromConfig(filepath.Join(dir, "xe.yml"))
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	watchers := e.Watchers()
+	if len(watchers) != 2 {
+		t.Fatalf("expected a file and a refresh watcher, got %#v", watchers)
+	}
+
+	if _, ok := watchers[0].(*config.FileWatcher); !ok {
+		t.Errorf("expected a file watcher for the envfile, got %#v", watchers[0])
+	}
+
+	if w, ok := watchers[1].(*config.PollWatcher); !ok || w.Interval != time.Minute {
+		t.Errorf("expected a poll watcher for the refresh, got %#v", watchers[1])
+	}
+}
+
+func TestFileWatcherFindsEnvFileChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xenv-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := "---\n- watch:\n    interval: 0\n- envfile: app.env\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "xe.yml"), []byte(cfg), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envfile := filepath.Join(dir, "app.env")
+	err = ioutil.WriteFile(envfile, []byte("FOO=bar\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := config.NewEnvironmentFromConfig(filepath.Join(dir, "xe.yml"))
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	events := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+
+	for _, w := range e.Watchers() {
+		err := w.Watch(events, stop)
+		if err != nil {
+			t.Fatalf("error starting watcher: %s", err)
+		}
+	}
+
+	// Writing the same values isn't a change.
+	err = ioutil.WriteFile(envfile, []byte("# same\nFOO=bar\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-events:
+		t.Fatal("unexpected change event")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	err = ioutil.WriteFile(envfile, []byte("FOO=baz\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitForEvent(t, events)
+}
+
+func TestWatchDisabled(t *testing.T) {
+	e, err := config.NewEnvironmentFromConfig("testdata/watch_disabled.yml")
+	if err != nil {
+		t.Fatalf("error loading config: %s", err)
+	}
+
+	err = e.Pre()
+	if err != nil {
+		t.Fatalf("error running config: %s", err)
+	}
+
+	if watchers := e.Watchers(); len(watchers) != 0 {
+		t.Errorf("expected no watchers, got %#v", watchers)
+	}
+}
@@ -1,48 +1,277 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"path/filepath"
 
 	"github.com/ghodss/yaml"
+	"github.com/ionrock/xenv/manager"
 	"github.com/ionrock/xenv/templates"
 )
 
 // Service is a service xenv config.
 type Service struct {
-	Name string `json:"name"`
-	Cmd  string `json:"cmd"`
-	Dir  string `json:"dir"`
+	Name string  `json:"name"`
+	Cmd  Command `json:"cmd"`
+	Dir  string  `json:"dir"`
+
+	// Shell runs the command when it isn't a list.
+	Shell Shell `json:"shell"`
+
+	// Restart is the restart policy for the service: always,
+	// on-failure or never. The default is never.
+	Restart string `json:"restart"`
+
+	// MaxRestarts limits how many times the service is restarted.
+	// Zero means there is no limit.
+	MaxRestarts int `json:"max_restarts"`
+
+	// Backoff is the delay before restarting the service, doubling
+	// with each restart up to MaxBackoff.
+	Backoff    Duration `json:"backoff"`
+	MaxBackoff Duration `json:"max_backoff"`
+
+	// ExitWithMain stops the service when the main command exits. When
+	// it is false the service keeps running until the post steps are
+	// done. The default is true.
+	ExitWithMain *bool `json:"exit_with_main"`
+
+	// MainExitsWith stops the main command when the service exits and
+	// will not be restarted.
+	MainExitsWith bool `json:"main_exits_with"`
+}
+
+// RestartPolicy returns the manager.RestartPolicy for the service.
+func (s *Service) RestartPolicy() manager.RestartPolicy {
+	return manager.RestartPolicy{
+		Restart:     s.Restart,
+		MaxRestarts: s.MaxRestarts,
+		Backoff:     s.Backoff.Std(),
+		MaxBackoff:  s.MaxBackoff.Std(),
+	}
+}
+
+// exitsWithMain reports if the service should be stopped as soon as
+// the main command exits.
+func (s *Service) exitsWithMain() bool {
+	return s.ExitWithMain == nil || *s.ExitWithMain
 }
 
 // XeTask is a task in a xenv config.
 type XeTask struct {
-	Name string `json:"name"`
-	Cmd  string `json:"cmd"`
-	Dir  string `json:"dir"`
+	Name string  `json:"name"`
+	Cmd  Command `json:"cmd"`
+	Dir  string  `json:"dir"`
+
+	// Shell runs the command when it isn't a list.
+	Shell Shell `json:"shell"`
+
+	// DependsOn names the tasks and envscripts that must finish
+	// first. Tasks and envscripts next to each other that set it run
+	// at the same time as their dependencies allow.
+	DependsOn []string `json:"depends_on"`
+
+	// Env are values added to the environment of the task. They are
+	// expanded using the config but are not added to it.
+	Env map[string]string `json:"env"`
+
+	// InheritEnv is false to run the task with only the values in
+	// Env. The default is true.
+	InheritEnv *bool `json:"inherit_env"`
+
+	// User and Group run the task as another user and group, given as
+	// a name or an id.
+	User  string `json:"user"`
+	Group string `json:"group"`
+
+	// Register is a key to store the output of the task in for the
+	// steps after it and the command.
+	Register string `json:"register"`
+
+	// Parse is how the output is read: yaml, json or lines. By
+	// default the output is stored as it is, without the whitespace
+	// around it. Parsed output is flattened with Register as the
+	// first level of the keys.
+	Parse string `json:"parse"`
+
+	FlattenOptions
+	RunOptions
+}
+
+// EnvFile is a dotenv, YAML, JSON or TOML file of values for the
+// environment.
+type EnvFile struct {
+	Path string `json:"path"`
+
+	// Format is one of dotenv, yaml, json or toml. By default it is
+	// found using the file extension.
+	Format string `json:"format"`
+
+	FlattenOptions
+}
+
+// path returns the path of the file relative to dir.
+func (ef *EnvFile) path(dir string) string {
+	if filepath.IsAbs(ef.Path) {
+		return ef.Path
+	}
+	return filepath.Join(dir, ef.Path)
+}
+
+// UnmarshalJSON allows an EnvFile to be only the path.
+func (ef *EnvFile) UnmarshalJSON(b []byte) error {
+	var path string
+	if err := json.Unmarshal(b, &path); err == nil {
+		ef.Path = path
+		return nil
+	}
+
+	type envFile EnvFile
+	return json.Unmarshal(b, (*envFile)(ef))
+}
+
+// EnvScript is a script that outputs YAML or JSON values for the
+// environment.
+type EnvScript struct {
+	Name string  `json:"name"`
+	Cmd  Command `json:"cmd"`
+
+	// Shell runs the command when it isn't a list.
+	Shell Shell `json:"shell"`
+
+	// DependsOn names the tasks and envscripts that must finish
+	// first, the same as for tasks.
+	DependsOn []string `json:"depends_on"`
+
+	FlattenOptions
+	RunOptions
+}
+
+// UnmarshalJSON allows an EnvScript to be only the command.
+func (es *EnvScript) UnmarshalJSON(b []byte) error {
+	var cmd Command
+	if err := json.Unmarshal(b, &cmd); err == nil {
+		es.Cmd = cmd
+		return nil
+	}
+
+	type envScript EnvScript
+	return json.Unmarshal(b, (*envScript)(es))
 }
 
 // the post in a xenv config.
 type XeConfig struct {
 	Service   *Service            `json:"service"`
 	Env       []map[string]string `json:"env"`
-	EnvScript string              `json:"envscript"`
+	EnvScript *EnvScript          `json:"envscript"`
+	EnvFile   *EnvFile            `json:"envfile"`
 	Task      *XeTask             `json:"task"`
 	Post      []*XeConfig         `json:"post"`
 	Template  *templates.Renderer `json:"template"`
+	Include   string              `json:"include"`
+
+	// Shell runs the command lines of the entries after it, unless
+	// they set their own.
+	Shell Shell `json:"shell"`
+
+	// Inherit is which values of the environment xenv was started
+	// with are passed on, from the entries after it.
+	Inherit *Inherit `json:"inherit"`
+
+	// When is a template that must render to true for the entry to
+	// be used.
+	When string `json:"when"`
+
+	// Secret marks the keys set by the entry as secret so their
+	// values are hidden in logs and output.
+	Secret bool `json:"secret"`
+
+	// Secrets is a list of patterns such as "*_TOKEN" for keys that
+	// are secret.
+	Secrets []string `json:"secrets"`
+
+	// Watch configures how changes are found while the command runs.
+	Watch *Watch `json:"watch"`
+
+	// Stop configures how the main command is stopped.
+	Stop *Stop `json:"stop"`
+
+	// OnChange is what happens when the config data changes while
+	// the command runs.
+	OnChange *OnChange `json:"on_change"`
+
+	// Refresh runs the entry again on its own interval to look for
+	// changes to the values it sets.
+	Refresh Duration `json:"refresh"`
+
+	// RunOptions set the timeout and retries of the commands in the
+	// values of the entry, and of its task or envscript when they
+	// don't set their own.
+	RunOptions
+
+	// file and index are where the entry was defined.
+	file  string
+	index int
+
+	// includeWhen are the conditions of the include entries the entry
+	// came from, outermost first.
+	includeWhen []string
 }
 
-// NewXeConfig parses a path for a *XeConfig.
+// conditions returns the conditions that must be true for the entry to
+// be used.
+func (cfg *XeConfig) conditions() []string {
+	conds := append([]string{}, cfg.includeWhen...)
+	if cfg.When != "" {
+		conds = append(conds, cfg.When)
+	}
+	return conds
+}
+
+// dir returns the directory of the file the entry was defined in.
+func (cfg *XeConfig) dir() string {
+	if cfg.file == "" {
+		return ""
+	}
+	return filepath.Dir(cfg.file)
+}
+
+// Location describes where the entry was defined for error messages.
+func (cfg *XeConfig) Location() string {
+	return location(cfg.file, cfg.index)
+}
+
+// source returns a Source for values set by the entry.
+func (cfg *XeConfig) source(kind, command string) Source {
+	return Source{
+		File:    cfg.file,
+		Index:   cfg.index,
+		Kind:    kind,
+		Command: command,
+		Secret:  cfg.Secret,
+	}
+}
+
+// NewXeConfig parses a path for a *XeConfig. The config is validated
+// first so mistakes are reported rather than ignored.
 func NewXeConfig(path string) ([]*XeConfig, error) {
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
+	err = Validate(path, b)
+	if err != nil {
+		return nil, err
+	}
+
 	config := make([]*XeConfig, 0)
 
 	err = yaml.Unmarshal(b, &config)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %s", path, err)
 	}
 
 	return config, nil
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
 	"sync"
 	"syscall"
 
@@ -17,8 +18,21 @@ import (
 type Manager struct {
 	Processes map[string]*kexec.KCommand
 
+	// NameWidth pads the name prefixed to each line of output so the
+	// output of several processes lines up.
+	NameWidth int
+
+	// Shell runs the commands passed to Start. The default is
+	// util.DefaultShell().
+	Shell []string
+
 	pipeWaits map[string]*sync.WaitGroup
-	lock      sync.Mutex
+	stopped   map[string]bool
+
+	// exited are the processes that were waited for and exited.
+	exited map[string]bool
+
+	lock sync.Mutex
 }
 
 // New creates a new *Manager.
@@ -26,6 +40,8 @@ func New() *Manager {
 	return &Manager{
 		Processes: make(map[string]*kexec.KCommand),
 		pipeWaits: make(map[string]*sync.WaitGroup),
+		stopped:   make(map[string]bool),
+		exited:    make(map[string]bool),
 	}
 
 }
@@ -54,24 +70,29 @@ func (m *Manager) HandleSignals() {
 	<-done
 }
 
+// prefix returns the name padded to the NameWidth.
+func (m *Manager) prefix(name string) string {
+	return fmt.Sprintf("%-*s", m.NameWidth, name)
+}
+
 // StdoutHandler returns an OutHandler that will ensure the underlying
 // process has an empty stdout buffer and logs to stdout a prefixed value
 // of "$name | $line".
 func (m *Manager) StdoutHandler(name string) util.OutHandler {
-	logCtx := log.WithFields(log.Fields{"name": name})
+	prefix := m.prefix(name)
 	return func(line string) string {
-		logCtx.Info(line)
+		fmt.Fprintf(os.Stdout, "%s | %s\n", prefix, line)
 		return ""
 	}
 }
 
 // StderrHandler returns an OutHandler that will ensure the underlying
-// process has an empty stderr buffer and logs to stdout a prefixed value
+// process has an empty stderr buffer and logs to stderr a prefixed value
 // of "$name | $line".
 func (m *Manager) StderrHandler(name string) util.OutHandler {
-	logCtx := log.WithFields(log.Fields{"name": name})
+	prefix := m.prefix(name)
 	return func(line string) string {
-		logCtx.Error(line)
+		fmt.Fprintf(os.Stderr, "%s | %s\n", prefix, line)
 		return ""
 	}
 }
@@ -79,7 +100,19 @@ func (m *Manager) StderrHandler(name string) util.OutHandler {
 // Start and managed a new process using the default handlers from a
 // string.
 func (m *Manager) Start(name, command, dir string, env []string) error {
-	cmd := kexec.Command("/bin/bash", "-c", command)
+	shell := m.Shell
+	if len(shell) == 0 {
+		shell = util.DefaultShell()
+	}
+
+	args := append(append([]string{}, shell...), command)
+	return m.StartArgs(name, args, dir, env)
+}
+
+// StartArgs starts and manages a new process running the program and
+// arguments without a shell.
+func (m *Manager) StartArgs(name string, args []string, dir string, env []string) error {
+	cmd := kexec.Command(args[0], args[1:]...)
 	cmd.Dir = dir
 	cmd.Env = env
 
@@ -96,6 +129,18 @@ func (m *Manager) StartProcessWithHandlers(name string, cmd *kexec.KCommand, o,
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
+	err := m.start(name, cmd, o, e)
+	if err != nil {
+		return err
+	}
+
+	delete(m.stopped, name)
+	return nil
+}
+
+// start starts the process and replaces the process with the same
+// name. The lock must be held.
+func (m *Manager) start(name string, cmd *kexec.KCommand, o, e util.OutHandler) error {
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		fmt.Printf("error creating stdout pipe: %s\n", err)
@@ -122,9 +167,23 @@ func (m *Manager) StartProcessWithHandlers(name string, cmd *kexec.KCommand, o,
 
 	m.Processes[name] = cmd
 	m.pipeWaits[name] = wg
+	delete(m.exited, name)
 
 	return nil
+}
 
+// Names returns the names of the managed processes in order. It can be
+// used while processes are restarted.
+func (m *Manager) Names() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	names := make([]string, 0, len(m.Processes))
+	for name := range m.Processes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // Stop will try to stop a managed process. If the process does not
@@ -139,12 +198,20 @@ func (m *Manager) Stop(name string) error {
 		return nil
 	}
 
-	// ProcessState means it is already exited.
-	if cmd.ProcessState != nil {
+	// Make sure a supervised process isn't restarted.
+	m.stopped[name] = true
+
+	// An exited process can't be signalled. The ProcessState isn't
+	// used as the process may be waited for at the same time.
+	if m.exited[name] {
 		return nil
 	}
 
+	// The process may have exited before it was marked as exited.
 	err := cmd.Terminate(syscall.SIGINT)
+	if err == os.ErrProcessDone || err == syscall.ESRCH {
+		return nil
+	}
 	if err != nil {
 		fmt.Println("Unable to term process")
 		return err
@@ -176,11 +243,11 @@ func (m *Manager) Wait() error {
 	wg.Add(len(m.Processes))
 
 	done := make(chan bool)
-	for _, cmd := range m.Processes {
-		go func(cmd *kexec.KCommand) {
+	for name, cmd := range m.Processes {
+		go func(name string, cmd *kexec.KCommand) {
 			defer wg.Done()
-			cmd.Wait()
-		}(cmd)
+			m.wait(name, cmd)
+		}(name, cmd)
 	}
 
 	go func() {
@@ -205,7 +272,21 @@ func (m *Manager) WaitFor(name string) error {
 		return errors.New("missing process")
 	}
 
-	return cmd.Wait()
+	return m.wait(name, cmd)
+}
+
+// wait waits for the process to exit and records that it exited.
+func (m *Manager) wait(name string, cmd *kexec.KCommand) error {
+	err := cmd.Wait()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// The process may have been restarted while it was waited for.
+	if m.Processes[name] == cmd {
+		m.exited[name] = true
+	}
+	return err
 }
 
 // Watch will watch any processes for exit and restart them.
@@ -225,34 +306,15 @@ func (m *Manager) Watch() error {
 	}()
 
 	// Start watchers for restart
-	for n, p := range m.Processes {
-		go func(n string, p *kexec.KCommand) {
-			for {
-				err := p.Wait()
-				if err != nil {
-					log.WithError(err).Info("error in process")
-				}
-
-				np := kexec.Command(p.Path)
-				np.Args = p.Args
-				np.Dir = p.Dir
-				np.Env = p.Env
-
-				log.Infof("restarting %s", n)
-				err = m.StartProcess(n, np)
-				if err != nil {
-					log.WithError(err).WithFields(log.Fields{
-						"np":   np.Path,
-						"args": np.Args,
-						"dir":  np.Dir,
-					}).Warn("error restarting process")
-					break
-				}
-
-				// pun intended...
-				p = np
-			}
-		}(n, p)
+	m.lock.Lock()
+	names := make([]string, 0, len(m.Processes))
+	for n := range m.Processes {
+		names = append(names, n)
+	}
+	m.lock.Unlock()
+
+	for _, n := range names {
+		m.Supervise(n, RestartPolicy{Restart: RestartAlways})
 	}
 
 	<-done
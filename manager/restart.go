@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codeskyblue/kexec"
+)
+
+// Restart policies supported by a RestartPolicy.
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNever     = "never"
+)
+
+// RestartPolicy defines when a managed process is restarted after it
+// exits.
+type RestartPolicy struct {
+	// Restart is one of RestartAlways, RestartOnFailure or
+	// RestartNever. An empty value is the same as RestartNever.
+	Restart string
+
+	// MaxRestarts limits the number of restarts. Zero means there is
+	// no limit.
+	MaxRestarts int
+
+	// Backoff is the delay before the first restart. It doubles with
+	// each restart up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// shouldRestart decides if a process that exited with err should be
+// restarted after the given number of restarts.
+func (p RestartPolicy) shouldRestart(err error, restarts int) bool {
+	if p.MaxRestarts > 0 && restarts >= p.MaxRestarts {
+		return false
+	}
+
+	switch p.Restart {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	}
+
+	return false
+}
+
+// delay returns how long to wait before the next restart.
+func (p RestartPolicy) delay(restarts int) time.Duration {
+	d := p.Backoff
+	for i := 0; i < restarts && d > 0; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return d
+}
+
+// Supervise watches a started process and restarts it according to
+// the policy. The returned channel receives the last exit error once
+// the process has exited and will not be restarted, either because
+// of the policy or because it was stopped.
+func (m *Manager) Supervise(name string, policy RestartPolicy) <-chan error {
+	exited := make(chan error, 1)
+
+	go func() {
+		restarts := 0
+		for {
+			err := m.waitProcess(name)
+			if err != nil {
+				log.WithField("name", name).WithError(err).Info("error in process")
+			}
+
+			if m.isStopped(name) || !policy.shouldRestart(err, restarts) {
+				exited <- err
+				return
+			}
+
+			time.Sleep(policy.delay(restarts))
+			restarts++
+
+			// We may have been stopped while waiting to restart.
+			rerr := m.restart(name)
+			if rerr == errStopped {
+				exited <- err
+				return
+			}
+			if rerr != nil {
+				log.WithError(rerr).WithField("name", name).Warn("error restarting process")
+				exited <- err
+				return
+			}
+		}
+	}()
+
+	return exited
+}
+
+// waitProcess waits for the output of the named process to be read
+// and then for the process to exit.
+func (m *Manager) waitProcess(name string) error {
+	m.lock.Lock()
+	cmd := m.Processes[name]
+	wg := m.pipeWaits[name]
+	m.lock.Unlock()
+
+	if wg != nil {
+		wg.Wait()
+	}
+
+	return m.wait(name, cmd)
+}
+
+func (m *Manager) isStopped(name string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.stopped[name]
+}
+
+// errStopped is returned by restart when the process was stopped.
+var errStopped = errors.New("process was stopped")
+
+// restart starts a new process using the command of the named
+// process unless it was stopped. The check and the start hold the
+// lock so a Stop can't be missed.
+func (m *Manager) restart(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.stopped[name] {
+		return errStopped
+	}
+
+	p := m.Processes[name]
+	np := kexec.Command(p.Path)
+	np.Args = p.Args
+	np.Dir = p.Dir
+	np.Env = p.Env
+
+	log.Infof("restarting %s", name)
+	return m.start(name, np, m.StdoutHandler(name), m.StderrHandler(name))
+}
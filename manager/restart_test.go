@@ -0,0 +1,94 @@
+package manager_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ionrock/xenv/manager"
+)
+
+func TestSuperviseRestartsOnFailure(t *testing.T) {
+	m := manager.New()
+
+	err := m.Start("flapper", "exit 1", ".", os.Environ())
+	if err != nil {
+		t.Fatalf("error starting process: %s", err)
+	}
+
+	policy := manager.RestartPolicy{
+		Restart:     manager.RestartOnFailure,
+		MaxRestarts: 2,
+		Backoff:     10 * time.Millisecond,
+	}
+
+	select {
+	case err := <-m.Supervise("flapper", policy):
+		if err == nil {
+			t.Errorf("expected the last exit error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("process was restarted too many times")
+	}
+}
+
+func TestSuperviseStopped(t *testing.T) {
+	m := manager.New()
+
+	err := m.Start("sleeper", "sleep 10", ".", os.Environ())
+	if err != nil {
+		t.Fatalf("error starting process: %s", err)
+	}
+
+	exited := m.Supervise("sleeper", manager.RestartPolicy{Restart: manager.RestartAlways})
+
+	err = m.Stop("sleeper")
+	if err != nil {
+		t.Fatalf("error stopping process: %s", err)
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stopped process was restarted")
+	}
+}
+
+func TestStopWhileRestarting(t *testing.T) {
+	m := manager.New()
+
+	for _, name := range []string{"b-flapper", "a-flapper"} {
+		err := m.Start(name, "exit 1", ".", os.Environ())
+		if err != nil {
+			t.Fatalf("error starting process: %s", err)
+		}
+	}
+
+	policy := manager.RestartPolicy{
+		Restart: manager.RestartAlways,
+		Backoff: time.Millisecond,
+	}
+	exited := []<-chan error{m.Supervise("a-flapper", policy), m.Supervise("b-flapper", policy)}
+
+	time.Sleep(50 * time.Millisecond)
+	names := m.Names()
+	if len(names) != 2 || names[0] != "a-flapper" || names[1] != "b-flapper" {
+		t.Fatalf("wrong names: %q", names)
+	}
+
+	// The names are read while the processes are restarted.
+	for _, name := range names {
+		err := m.Stop(name)
+		if err != nil {
+			t.Errorf("error stopping %s: %s", name, err)
+		}
+	}
+
+	for _, ch := range exited {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("stopped process was restarted")
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package reaper runs xenv as an init process. It starts a child
+// process, passes signals on to it and reaps any orphaned processes
+// until the child exits.
+package reaper
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ChildEnv is set in the environment of the child so it knows it is
+// already running under the reaper.
+const ChildEnv = "XENV_REAPER_CHILD"
+
+// IsChild reports if the process was started by the reaper.
+func IsChild() bool {
+	return os.Getenv(ChildEnv) != ""
+}
+
+// Run starts args as a child in its own process group and waits for
+// it to exit, reaping any other processes that exit in the meantime.
+// Signals are passed on to the process group of the child. It returns
+// the exit code of the child, or 128 plus the signal that killed it.
+func Run(args []string) int {
+	err := setSubreaper()
+	if err != nil {
+		log.WithError(err).Warn("error becoming a subreaper")
+	}
+
+	// Listen before starting the child so no exits are missed.
+	sigs := make(chan os.Signal, 16)
+	signal.Notify(sigs)
+	defer signal.Stop(sigs)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), ChildEnv+"=1")
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err = cmd.Start()
+	if err != nil {
+		log.WithError(err).Error("error starting child")
+		return 1
+	}
+	pid := cmd.Process.Pid
+
+	for sig := range sigs {
+		switch sig {
+		case syscall.SIGCHLD:
+			if status, ok := reap(pid); ok {
+				return ExitCode(status)
+			}
+		case syscall.SIGURG:
+			// Used by the Go runtime.
+		default:
+			err := syscall.Kill(-pid, sig.(syscall.Signal))
+			if err != nil {
+				log.WithError(err).WithField("signal", sig).Debug("error forwarding signal")
+			}
+		}
+	}
+
+	return 1
+}
+
+// reap waits for all the processes that have exited. It reports the
+// status of the child when it is one of them.
+func reap(child int) (syscall.WaitStatus, bool) {
+	var (
+		childStatus syscall.WaitStatus
+		childExited bool
+	)
+
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || pid <= 0 {
+			return childStatus, childExited
+		}
+
+		if pid == child {
+			childStatus, childExited = status, true
+			continue
+		}
+		log.WithField("pid", pid).Debug("reaped process")
+	}
+}
+
+// ExitCode returns the exit code for a wait status, which is 128 plus
+// the signal when the process was killed by a signal.
+func ExitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
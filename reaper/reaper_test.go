@@ -0,0 +1,71 @@
+package reaper_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ionrock/xenv/reaper"
+)
+
+// zombies returns the pids of exited children that haven't been
+// reaped.
+func zombies(t *testing.T) []int {
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pids := []int{}
+	for _, stat := range stats {
+		b, err := ioutil.ReadFile(stat)
+		if err != nil {
+			continue
+		}
+
+		// The command name may have spaces, so start after it.
+		fields := strings.Fields(string(b[strings.LastIndex(string(b), ")")+1:]))
+		if len(fields) < 2 || fields[0] != "Z" || fields[1] != strconv.Itoa(os.Getpid()) {
+			continue
+		}
+
+		pid, _ := strconv.Atoi(filepath.Base(filepath.Dir(stat)))
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+func TestRunExitCode(t *testing.T) {
+	code := reaper.Run([]string{"sh", "-c", "exit 3"})
+	if code != 3 {
+		t.Errorf("expected exit code 3, got %d", code)
+	}
+}
+
+func TestRunKilledBySignal(t *testing.T) {
+	code := reaper.Run([]string{"sh", "-c", "kill -TERM $$"})
+	if code != 143 {
+		t.Errorf("expected exit code 143, got %d", code)
+	}
+}
+
+func TestRunReapsOrphans(t *testing.T) {
+	code := reaper.Run([]string{"sh", "-c", "(sleep 0.05 &); sleep 0.3"})
+	if code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+
+	if pids := zombies(t); len(pids) > 0 {
+		t.Errorf("orphans were not reaped: %v", pids)
+	}
+}
+
+func TestRunMissingCommand(t *testing.T) {
+	code := reaper.Run([]string{"/does/not/exist"})
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+}
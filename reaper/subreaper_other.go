@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package reaper
+
+// setSubreaper does nothing where there are no subreapers. Orphans are
+// only reaped when running as PID 1.
+func setSubreaper() error {
+	return nil
+}
@@ -0,0 +1,39 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+)
+
+// Condition renders expr as a template using the env for data and
+// reports if the result is true. An empty result is false and missing
+// keys render as empty strings.
+func Condition(expr string, env map[string]string) (bool, error) {
+	tmpl, err := template.New("when").Funcs(sprig.TxtFuncMap()).Option("missingkey=zero").Parse(expr)
+	if err != nil {
+		return false, err
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, env)
+	if err != nil {
+		return false, err
+	}
+
+	result := strings.TrimSpace(b.String())
+	if result == "" {
+		return false, nil
+	}
+
+	ok, err := strconv.ParseBool(result)
+	if err != nil {
+		return false, fmt.Errorf("condition %q is not true or false: %q", expr, result)
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,42 @@
+package templates_test
+
+import (
+	"testing"
+
+	"github.com/ionrock/xenv/templates"
+)
+
+func TestCondition(t *testing.T) {
+	env := map[string]string{
+		"ENV":   "prod",
+		"DEBUG": "false",
+	}
+
+	tests := map[string]bool{
+		`{{ eq .ENV "prod" }}`: true,
+		`{{ eq .ENV "dev" }}`:  false,
+		`{{ .DEBUG }}`:         false,
+		`{{ .MISSING }}`:       false,
+		`{{ and (eq .ENV "prod") (empty .MISSING) }}`: true,
+		`true`: true,
+	}
+
+	for expr, expected := range tests {
+		result, err := templates.Condition(expr, env)
+		if err != nil {
+			t.Errorf("error evaluating %q: %s", expr, err)
+			continue
+		}
+
+		if result != expected {
+			t.Errorf("wrong result for %q: %t != %t", expr, result, expected)
+		}
+	}
+}
+
+func TestConditionNotBool(t *testing.T) {
+	_, err := templates.Condition("{{ .ENV }}", map[string]string{"ENV": "prod"})
+	if err == nil {
+		t.Errorf("expected an error for a non boolean condition")
+	}
+}
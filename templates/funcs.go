@@ -0,0 +1,243 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Masterminds/sprig"
+	"github.com/ghodss/yaml"
+	"github.com/ionrock/xenv/util"
+)
+
+// DefaultExecTimeout is how long a command run with exec can take
+// when no timeout is given.
+const DefaultExecTimeout = 10 * time.Second
+
+// Funcs returns the sprig helpers with the xenv functions for a
+// template. The Env is used to look up values and to run commands with
+// the Shell. Paths are relative to dir.
+//
+//	env "KEY" "default"   the value of KEY or the default when it is empty
+//	required "KEY"        the value of KEY or an error when it is empty
+//	file "path"           the content of a file
+//	base64File "path"     the content of a file encoded as base64
+//	exec "cmd" "5s"       the output of a command line with a timeout
+//	toYaml, toToml, toIni a value encoded in the format
+//
+// With NoExec, exec returns a placeholder instead of running the
+// command.
+func (conf *Renderer) Funcs(dir string) template.FuncMap {
+	env := conf.Env
+	funcs := sprig.TxtFuncMap()
+
+	funcs["env"] = func(k string, def ...string) string {
+		if v := env[k]; v != "" || len(def) == 0 {
+			return v
+		}
+		return def[0]
+	}
+
+	funcs["required"] = func(k string) (string, error) {
+		v := env[k]
+		if v == "" {
+			return "", fmt.Errorf("required key %s is not set", k)
+		}
+		return v, nil
+	}
+
+	funcs["file"] = func(path string) (string, error) {
+		b, err := readFile(dir, path)
+		return string(b), err
+	}
+
+	funcs["base64File"] = func(path string) (string, error) {
+		b, err := readFile(dir, path)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	}
+
+	funcs["exec"] = func(line string, timeout ...string) (string, error) {
+		if conf.NoExec {
+			return fmt.Sprintf("<command not run: %s>", line), nil
+		}
+		return execLine(conf.Shell, dir, env, line, timeout...)
+	}
+
+	funcs["toYaml"] = toYaml
+	funcs["toToml"] = toToml
+	funcs["toIni"] = toIni
+
+	return funcs
+}
+
+func readFile(dir, path string) ([]byte, error) {
+	path, err := makeAbs(dir, path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
+
+// execLine runs the command line with the shell, or the default shell
+// when it is empty, and returns its output without the trailing
+// newlines. The command and anything it started are killed after the
+// timeout.
+func execLine(shell []string, dir string, env map[string]string, line string, timeout ...string) (string, error) {
+	limit := DefaultExecTimeout
+	if len(timeout) > 0 {
+		var err error
+		limit, err = time.ParseDuration(timeout[0])
+		if err != nil {
+			return "", fmt.Errorf("invalid timeout for %q: %s", line, err)
+		}
+	}
+
+	if len(shell) == 0 {
+		shell = util.DefaultShell()
+	}
+	args := append(append([]string{}, shell...), line)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if env != nil {
+		cmd.Env = []string{}
+		for _, k := range sortedKeys(env) {
+			cmd.Env = append(cmd.Env, k+"="+env[k])
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Start()
+	if err != nil {
+		return "", err
+	}
+
+	var killed int32
+	pgid := cmd.Process.Pid
+	timer := time.AfterFunc(limit, func() {
+		atomic.StoreInt32(&killed, 1)
+		syscall.Kill(-pgid, syscall.SIGKILL)
+	})
+	err = cmd.Wait()
+	timer.Stop()
+
+	if atomic.LoadInt32(&killed) == 1 {
+		return "", fmt.Errorf("command %q timed out after %s", line, limit)
+	}
+	if err != nil {
+		return "", fmt.Errorf("command %q failed: %s: %s", line, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+func toYaml(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+func toToml(v interface{}) (string, error) {
+	var b bytes.Buffer
+	err := toml.NewEncoder(&b).Encode(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// toIni encodes a map as INI. The values of nested maps are written in
+// sections named with their keys joined by dots and lists are written
+// as a line for each item.
+func toIni(v interface{}) (string, error) {
+	// Use the same types as decoded data, whatever was passed.
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return "", fmt.Errorf("toIni needs a map: %s", err)
+	}
+
+	lines := []string{}
+	writeIniSection(&lines, "", m)
+	return strings.Join(lines, "\n"), nil
+}
+
+func writeIniSection(lines *[]string, name string, m map[string]interface{}) {
+	if name != "" {
+		if len(*lines) > 0 {
+			*lines = append(*lines, "")
+		}
+		*lines = append(*lines, "["+name+"]")
+	}
+
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	sections := []string{}
+	for _, k := range keys {
+		switch v := m[k].(type) {
+		case map[string]interface{}:
+			sections = append(sections, k)
+		case []interface{}:
+			for _, item := range v {
+				*lines = append(*lines, fmt.Sprintf("%s = %s", k, iniValue(item)))
+			}
+		default:
+			*lines = append(*lines, fmt.Sprintf("%s = %s", k, iniValue(v)))
+		}
+	}
+
+	for _, k := range sections {
+		section := k
+		if name != "" {
+			section = name + "." + k
+		}
+		writeIniSection(lines, section, m[k].(map[string]interface{}))
+	}
+}
+
+func iniValue(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,122 @@
+package templates_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ionrock/xenv/templates"
+)
+
+func renderString(t *testing.T, content string, strict bool) (string, error) {
+	dir, err := ioutil.TempDir("", "xenv-funcs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTemplate(t, dir, content)
+	err = ioutil.WriteFile(filepath.Join(dir, "cert.pem"), []byte("cert\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := templates.Renderer{
+		Template: "app.tmpl",
+		Strict:   strict,
+		Env:      map[string]string{"FOO": "foo", "EMPTY": ""},
+		Data: map[string]interface{}{
+			"db": map[string]interface{}{"host": "db", "ports": []interface{}{5432, 5433}},
+		},
+	}
+
+	b, err := conf.Render(dir)
+	return string(b), err
+}
+
+func TestFuncs(t *testing.T) {
+	tests := []struct {
+		tmpl     string
+		expected string
+	}{
+		{`{{ env "FOO" "x" }} {{ env "EMPTY" "x" }} {{ env "MISSING" "x" }} {{ env "MISSING" }}.`, "foo x x ."},
+		{`{{ required "FOO" }}`, "foo"},
+		{`{{ file "cert.pem" }}`, "cert\n"},
+		{`{{ base64File "cert.pem" }}`, "Y2VydAo="},
+		{`{{ exec "echo $FOO; ls cert.pem" }}`, "foo\ncert.pem"},
+		{`{{ toYaml .Data.db }}`, "host: db\nports:\n- 5432\n- 5433"},
+		{`{{ toToml .Data.db }}`, "host = \"db\"\nports = [5432, 5433]"},
+		{`{{ toIni .Data }}`, "[db]\nhost = db\nports = 5432\nports = 5433"},
+	}
+
+	for _, tc := range tests {
+		result, err := renderString(t, tc.tmpl, false)
+		if err != nil {
+			t.Errorf("%s: error rendering: %s", tc.tmpl, err)
+			continue
+		}
+		if result != tc.expected {
+			t.Errorf("%s: wrong content: %q", tc.tmpl, result)
+		}
+	}
+}
+
+func TestFuncErrors(t *testing.T) {
+	tests := []struct {
+		tmpl     string
+		strict   bool
+		expected string
+	}{
+		{`{{ required "EMPTY" }}`, false, "required key EMPTY is not set"},
+		{`{{ file "missing.txt" }}`, false, "no such file"},
+		{`{{ exec "exit 3" }}`, false, "exit status 3"},
+		{`{{ exec "sleep 5" "100ms" }}`, false, "timed out after 100ms"},
+		{`{{ .MISSING }}`, true, `no entry for key "MISSING"`},
+		{`{{ .Data.db.user }}`, true, `no entry for key "user"`},
+	}
+
+	for _, tc := range tests {
+		_, err := renderString(t, tc.tmpl, tc.strict)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: expected an error with %q, got %v", tc.tmpl, tc.expected, err)
+		}
+	}
+
+	result, err := renderString(t, `{{ .MISSING }}`, false)
+	if err != nil || result != "<no value>" {
+		t.Errorf("expected missing keys to render without strict: %q, %v", result, err)
+	}
+}
+
+func TestExecOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xenv-funcs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTemplate(t, dir, `{{ exec "touch ran; echo $0" }}`)
+
+	conf := templates.Renderer{Template: "app.tmpl", NoExec: true}
+	b, err := conf.Render(dir)
+	if err != nil {
+		t.Fatalf("error rendering: %s", err)
+	}
+	if string(b) != "<command not run: touch ran; echo $0>" {
+		t.Errorf("wrong content without exec: %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran")); !os.IsNotExist(err) {
+		t.Errorf("expected the command not to run: %v", err)
+	}
+
+	conf = templates.Renderer{Template: "app.tmpl", Shell: []string{"/bin/sh", "-c"}}
+	b, err = conf.Render(dir)
+	if err != nil {
+		t.Fatalf("error rendering: %s", err)
+	}
+	if string(b) != "/bin/sh" {
+		t.Errorf("expected the command to run with the shell: %q", b)
+	}
+}
@@ -1,14 +1,18 @@
 package templates
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
-	"os/user"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"text/template"
 
-	"github.com/Masterminds/sprig"
+	"github.com/ionrock/xenv/util"
 )
 
 // Renderer provides the ability to write a template using the
@@ -19,7 +23,67 @@ type Renderer struct {
 	Owner    string `json:"owner"`
 	Group    string `json:"group"`
 	FileMode string `json:"mode"`
-	Env      map[string]string
+
+	// Content is an inline template used instead of a Template file.
+	Content string `json:"content"`
+
+	// SourceDir is a directory of templates that are rendered to the
+	// same relative paths in TargetDir, less the StripExtension.
+	SourceDir      string `json:"source_dir"`
+	TargetDir      string `json:"target_dir"`
+	StripExtension string `json:"strip_extension"`
+
+	// Partials is a glob of templates parsed with each template so
+	// they can be used with {{ template "name" }}. Partials in the
+	// SourceDir aren't rendered themselves.
+	Partials string `json:"partials"`
+
+	// Backup keeps the previous version of the target with a .bak
+	// extension when it changes.
+	Backup bool `json:"backup"`
+
+	// OnChange is what happens when the target changes while the
+	// command runs.
+	OnChange *OnChange `json:"on_change"`
+
+	// Strict fails rendering when the template uses a missing key
+	// instead of writing "<no value>".
+	Strict bool `json:"strict"`
+
+	Env map[string]string `json:"-"`
+
+	// Data is the structured data of envfiles, envscripts and
+	// registered task output.
+	Data map[string]interface{} `json:"-"`
+
+	// Shell runs the commands of exec. The default is
+	// util.DefaultShell().
+	Shell []string `json:"-"`
+
+	// NoExec keeps exec from running commands.
+	NoExec bool `json:"-"`
+}
+
+// OnChange is a hook that is run when a template is rendered again and
+// the target changed.
+type OnChange struct {
+	// Task is the name of a task to run.
+	Task string `json:"task"`
+
+	// Signal is sent to the command, such as SIGHUP.
+	Signal string `json:"signal"`
+
+	// Restart restarts the command.
+	Restart bool `json:"restart"`
+}
+
+// File is a template and the target it is rendered to.
+type File struct {
+	// Template is the path of the template. It is empty for the
+	// Content of the Renderer.
+	Template string
+
+	Target string
 }
 
 func makeAbs(root, path string) (string, error) {
@@ -29,105 +93,401 @@ func makeAbs(root, path string) (string, error) {
 	return filepath.Abs(path)
 }
 
-// Execute renders the template to the specified target.
-func (conf *Renderer) Execute(dir string) error {
+// Check checks that the Renderer has one kind of template with a
+// target.
+func (conf *Renderer) Check() error {
+	sources := 0
+	for _, s := range []string{conf.Template, conf.Content, conf.SourceDir} {
+		if s != "" {
+			sources++
+		}
+	}
+
+	switch {
+	case sources != 1:
+		return errors.New("template needs one of template, content or source_dir")
+	case conf.SourceDir != "" && conf.TargetDir == "":
+		return errors.New("source_dir needs a target_dir")
+	case conf.SourceDir == "" && conf.Target == "":
+		return errors.New("template needs a target")
+	}
 
-	target, err := makeAbs(dir, conf.Target)
+	if conf.Partials != "" {
+		if _, err := filepath.Match(conf.Partials, ""); err != nil {
+			return fmt.Errorf("invalid partials %q: %s", conf.Partials, err)
+		}
+	}
+	return nil
+}
+
+// Destination is the target or the target directory.
+func (conf *Renderer) Destination() string {
+	if conf.SourceDir != "" {
+		return conf.TargetDir
+	}
+	return conf.Target
+}
+
+// Files returns the templates with their targets as absolute paths
+// relative to dir. Each file in the SourceDir that isn't a partial is
+// a template.
+func (conf *Renderer) Files(dir string) ([]File, error) {
+	if conf.SourceDir == "" {
+		target, err := makeAbs(dir, conf.Target)
+		if err != nil {
+			return nil, err
+		}
+
+		f := File{Target: target}
+		if conf.Template != "" {
+			f.Template, err = makeAbs(dir, conf.Template)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return []File{f}, nil
+	}
+
+	src, err := makeAbs(dir, conf.SourceDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	fh, err := os.Create(target)
+	dst, err := makeAbs(dir, conf.TargetDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	defer fh.Close()
+	partials, err := conf.partials(dir)
+	if err != nil {
+		return nil, err
+	}
 
-	tmpl, err := makeAbs(dir, conf.Template)
+	files := []File{}
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || partials[path] {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, File{
+			Template: path,
+			Target:   filepath.Join(dst, strings.TrimSuffix(rel, conf.StripExtension)),
+		})
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = ApplyTemplate(tmpl, fh, conf.Env)
+	return files, nil
+}
+
+// Sources returns the template files and partials that are rendered.
+func (conf *Renderer) Sources(dir string) ([]string, error) {
+	files, err := conf.Files(dir)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	sources := []string{}
+	for _, f := range files {
+		if f.Template != "" {
+			sources = append(sources, f.Template)
+		}
 	}
 
-	err = conf.SetPermissions()
+	partials, err := conf.partials(dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	for path := range partials {
+		sources = append(sources, path)
+	}
+	return sources, nil
 }
 
-// ApplyTemplate will takea template and write the output to the
-// provided io.Writer adding the sprig helpers and using the provided env
-// for data.
-func ApplyTemplate(t string, fh io.Writer, env map[string]string) error {
-	name := filepath.Base(t)
+// partials returns the paths matching the Partials glob.
+func (conf *Renderer) partials(dir string) (map[string]bool, error) {
+	paths := make(map[string]bool)
+	if conf.Partials == "" {
+		return paths, nil
+	}
 
-	// Parse the template adding our sprig helpers
-	tmpl, err := template.New(name).Funcs(sprig.TxtFuncMap()).ParseFiles(t)
+	pattern, err := makeAbs(dir, conf.Partials)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range matches {
+		paths[path] = true
+	}
+	return paths, nil
+}
+
+// Execute renders the templates to their targets and reports if any
+// target changed. A template is rendered first and written to a temp
+// file that replaces the target, so the target is never left partly
+// written. The target is only replaced when the content is different,
+// keeping the previous version when Backup is set.
+func (conf *Renderer) Execute(dir string) (bool, error) {
+	files, err := conf.Files(dir)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, f := range files {
+		rendered, err := conf.RenderFile(dir, f)
+		if err != nil {
+			return changed, err
+		}
+
+		ok, err := conf.write(f.Target, rendered)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || ok
+	}
+
+	return changed, nil
+}
+
+// write replaces the target with the rendered content when it is
+// different and reports if it changed.
+func (conf *Renderer) write(target string, rendered []byte) (bool, error) {
+	current, err := ioutil.ReadFile(target)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if exists && bytes.Equal(current, rendered) {
+		return false, conf.setPermissions(target)
 	}
 
-	// Execute the template with our environment
-	err = tmpl.Execute(fh, env)
+	if exists && conf.Backup {
+		err = conf.backup(target, current)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return false, err
+	}
+
+	err = conf.writeAtomic(target, rendered)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// backup writes the current content of the target next to it with a
+// .bak extension.
+func (conf *Renderer) backup(target string, current []byte) error {
+	mode, err := conf.mode(target)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	return ioutil.WriteFile(target+".bak", current, mode)
 }
 
-// SetPermissions ensures the user, group and file mode are set on the target file.
-func (conf *Renderer) SetPermissions() error {
+// writeAtomic writes the content to a temp file in the directory of
+// the target, sets its permissions and syncs it before renaming it to
+// the target.
+func (conf *Renderer) writeAtomic(target string, content []byte) error {
+	mode, err := conf.mode(target)
+	if err != nil {
+		return err
+	}
+
+	fh, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".")
+	if err != nil {
+		return err
+	}
+	tmp := fh.Name()
 
-	var uid int
-	var gid int
+	// The temp file is renamed unless something went wrong.
+	defer os.Remove(tmp)
 
-	// Set some defaults based on the current user
-	u, err := user.Current()
+	_, err = fh.Write(content)
+	if err == nil {
+		err = fh.Sync()
+	}
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp, mode)
 	if err != nil {
 		return err
 	}
 
-	g, err := user.LookupGroupId(u.Gid)
+	err = conf.chown(tmp)
 	if err != nil {
 		return err
 	}
 
-	// If we have an owner, update the user var
-	if conf.Owner != "" {
-		u, err = user.Lookup(conf.Owner)
+	return os.Rename(tmp, target)
+}
+
+// mode returns the file mode for the target: the FileMode when it is
+// set, or else the mode of the existing target or 0644.
+func (conf *Renderer) mode(target string) (os.FileMode, error) {
+	if conf.FileMode != "" {
+		mode, err := strconv.ParseUint(conf.FileMode, 0, 32)
+		if err != nil {
+			return 0, err
+		}
+		return os.FileMode(mode), nil
+	}
+
+	info, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		return 0644, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Mode().Perm(), nil
+}
+
+// TemplatePath returns the absolute path of the template relative to
+// dir.
+func (conf *Renderer) TemplatePath(dir string) (string, error) {
+	return makeAbs(dir, conf.Template)
+}
+
+// TargetPath returns the absolute path of the target relative to dir.
+func (conf *Renderer) TargetPath(dir string) (string, error) {
+	return makeAbs(dir, conf.Target)
+}
+
+// Render renders the template or content relative to dir without
+// writing the target.
+func (conf *Renderer) Render(dir string) ([]byte, error) {
+	f := File{}
+	if conf.Template != "" {
+		tmpl, err := makeAbs(dir, conf.Template)
+		if err != nil {
+			return nil, err
+		}
+		f.Template = tmpl
+	}
+
+	return conf.RenderFile(dir, f)
+}
+
+// RenderFile renders one of the Files relative to dir without writing
+// the target.
+func (conf *Renderer) RenderFile(dir string, f File) ([]byte, error) {
+	var b bytes.Buffer
+	err := conf.render(&b, dir, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// render parses the partials and then the template of the file, adding
+// the funcs, and executes it with the environment. A strict template
+// fails on missing keys.
+func (conf *Renderer) render(fh io.Writer, dir string, f File) error {
+	tmpl := template.New("").Funcs(conf.Funcs(dir))
+	if conf.Strict {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+
+	if conf.Partials != "" {
+		pattern, err := makeAbs(dir, conf.Partials)
+		if err != nil {
+			return err
+		}
+
+		tmpl, err = tmpl.ParseGlob(pattern)
 		if err != nil {
 			return err
 		}
 	}
 
-	// if we have a group, update the group var
-	if conf.Group != "" {
-		g, err = user.LookupGroup(conf.Group)
+	name, content := "content", conf.Content
+	if f.Template != "" {
+		b, err := ioutil.ReadFile(f.Template)
 		if err != nil {
-			return nil
+			return err
 		}
+		name, content = filepath.Base(f.Template), string(b)
 	}
 
-	// set the user and group id vars
-	uid, err = strconv.Atoi(u.Uid)
+	// The template is parsed last so it isn't replaced by a partial
+	// with the same name.
+	tmpl, err := tmpl.New(name).Parse(content)
 	if err != nil {
 		return err
 	}
 
-	gid, err = strconv.Atoi(g.Gid)
-	if err != nil {
-		return nil
+	return tmpl.Execute(fh, Values(conf.Env, conf.Data))
+}
+
+// ApplyTemplate will takea template and write the output to the
+// provided io.Writer adding the sprig helpers and using the provided env
+// for data.
+func ApplyTemplate(t string, fh io.Writer, env map[string]string) error {
+	conf := &Renderer{Template: t, Env: env}
+	return conf.render(fh, "", File{Template: t})
+}
+
+// Values returns the data templates are executed with. The values of
+// the environment can be used as {{ .FOO }} or {{ .Env.FOO }} and the
+// structured data as {{ .Data.foo.bar }}. Env and Data take the place
+// of values with the same names.
+func Values(env map[string]string, data map[string]interface{}) map[string]interface{} {
+	if env == nil {
+		env = map[string]string{}
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	values := make(map[string]interface{}, len(env)+2)
+	for k, v := range env {
+		values[k] = v
 	}
+	values["Env"] = env
+	values["Data"] = data
+	return values
+}
+
+// SetPermissions ensures the user, group and file mode are set on the target file.
+func (conf *Renderer) SetPermissions() error {
+	return conf.setPermissions(conf.Target)
+}
 
-	// chown the file
-	err = os.Chown(conf.Target, uid, gid)
+func (conf *Renderer) setPermissions(path string) error {
+	err := conf.chown(path)
 	if err != nil {
 		return err
 	}
@@ -138,8 +498,18 @@ func (conf *Renderer) SetPermissions() error {
 			return err
 		}
 
-		os.Chmod(conf.Target, os.FileMode(mode))
+		return os.Chmod(path, os.FileMode(mode))
 	}
 
 	return nil
 }
+
+// chown sets the owner and group of the file.
+func (conf *Renderer) chown(path string) error {
+	uid, gid, err := util.LookupIDs(conf.Owner, conf.Group)
+	if err != nil {
+		return err
+	}
+
+	return os.Chown(path, uid, gid)
+}
@@ -2,7 +2,10 @@ package templates_test
 
 import (
 	"bytes"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/ionrock/xenv/templates"
@@ -63,3 +66,278 @@ func TestConfigTmplFileInfo(t *testing.T) {
 		t.Errorf("failed to set mode: %q != %q", info.Mode(), mode)
 	}
 }
+
+func writeTemplate(t *testing.T, dir, content string) {
+	err := ioutil.WriteFile(filepath.Join(dir, "app.tmpl"), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecuteOnlyWritesChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xenv-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTemplate(t, dir, "name={{ .NAME }}\n")
+	conf := templates.Renderer{
+		Template: "app.tmpl",
+		Target:   "app.cfg",
+		FileMode: "0640",
+		Backup:   true,
+		Env:      map[string]string{"NAME": "one"},
+	}
+	target := filepath.Join(dir, "app.cfg")
+
+	changed, err := conf.Execute(dir)
+	if err != nil || !changed {
+		t.Fatalf("expected the target to be written: %v %v", changed, err)
+	}
+
+	before, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Mode().Perm() != 0640 {
+		t.Errorf("wrong mode: %s", before.Mode())
+	}
+
+	changed, err = conf.Execute(dir)
+	if err != nil || changed {
+		t.Fatalf("expected the target to be left alone: %v %v", changed, err)
+	}
+
+	after, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("expected the same file when nothing changed")
+	}
+
+	conf.Env["NAME"] = "two"
+	changed, err = conf.Execute(dir)
+	if err != nil || !changed {
+		t.Fatalf("expected the target to change: %v %v", changed, err)
+	}
+
+	for name, expected := range map[string]string{"app.cfg": "name=two\n", "app.cfg.bak": "name=one\n"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Errorf("wrong content for %s: %q", name, b)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, ".app.cfg.*"))
+	if len(files) > 0 {
+		t.Errorf("temp files were left: %v", files)
+	}
+}
+
+func TestExecuteErrorKeepsTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xenv-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "app.cfg")
+	err = ioutil.WriteFile(target, []byte("working\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTemplate(t, dir, "name={{ .NAME | nosuchfunc }}\n")
+	conf := templates.Renderer{
+		Template: "app.tmpl",
+		Target:   "app.cfg",
+		Env:      map[string]string{"NAME": "one"},
+	}
+
+	changed, err := conf.Execute(dir)
+	if err == nil || changed {
+		t.Fatalf("expected an error: %v %v", changed, err)
+	}
+
+	b, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "working\n" {
+		t.Errorf("target was changed: %q", b)
+	}
+
+	writeTemplate(t, dir, "name={{ .NAME }}\n")
+	_, err = conf.Execute(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the mode of the target to be kept: %s", info.Mode())
+	}
+}
+
+func TestValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xenv-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTemplate(t, dir, `{{ .FOO }} {{ .Env.FOO }}{{ range .Data.hosts }} {{ . }}{{ end }}`)
+
+	conf := templates.Renderer{
+		Template: "app.tmpl",
+		Env:      map[string]string{"FOO": "foo"},
+		Data:     map[string]interface{}{"hosts": []interface{}{"a", "b"}},
+	}
+
+	b, err := conf.Render(dir)
+	if err != nil {
+		t.Fatalf("error rendering: %s", err)
+	}
+
+	if string(b) != "foo foo a b" {
+		t.Errorf("wrong content: %q", b)
+	}
+}
+
+func TestExecuteContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xenv-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "common.tmpl"), []byte(`{{ define "common" }}# {{ .NAME }}{{ end }}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := templates.Renderer{
+		Content:  "{{ template \"common\" . }}\nname={{ .NAME }}\n",
+		Target:   "conf/app.cfg",
+		Partials: "*.tmpl",
+		Env:      map[string]string{"NAME": "one"},
+	}
+
+	changed, err := conf.Execute(dir)
+	if err != nil || !changed {
+		t.Fatalf("expected the target to be written: %v %v", changed, err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "conf", "app.cfg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "# one\nname=one\n" {
+		t.Errorf("wrong content: %q", b)
+	}
+}
+
+func TestExecuteSourceDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xenv-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"src/app.cfg.tmpl":        "{{ template \"header\" . }}app={{ .NAME }}\n",
+		"src/conf.d/db.cfg.tmpl":  "{{ template \"header\" . }}db={{ .NAME }}\n",
+		"src/plain.txt":           "{{ .NAME }}\n",
+		"src/_partials/head.tmpl": "{{ define \"header\" }}# {{ .NAME }}\n{{ end }}",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf := templates.Renderer{
+		SourceDir:      "src",
+		TargetDir:      "out",
+		StripExtension: ".tmpl",
+		Partials:       "src/_partials/*.tmpl",
+		Env:            map[string]string{"NAME": "one"},
+	}
+
+	changed, err := conf.Execute(dir)
+	if err != nil || !changed {
+		t.Fatalf("expected the targets to be written: %v %v", changed, err)
+	}
+
+	expected := map[string]string{
+		"out/app.cfg":        "# one\napp=one\n",
+		"out/conf.d/db.cfg":  "# one\ndb=one\n",
+		"out/plain.txt":      "one\n",
+		"out/_partials/head": "",
+	}
+	for name, v := range expected {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if v == "" {
+			if err == nil {
+				t.Errorf("expected the partial %s not to be rendered", name)
+			}
+			continue
+		}
+		if err != nil || string(b) != v {
+			t.Errorf("wrong content for %s: %q %v", name, b, err)
+		}
+	}
+
+	changed, err = conf.Execute(dir)
+	if err != nil || changed {
+		t.Errorf("expected the targets to be unchanged: %v %v", changed, err)
+	}
+
+	sources, err := conf.Sources(dir)
+	if err != nil || len(sources) != len(files) {
+		t.Errorf("expected the templates and partials as sources: %q %v", sources, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		conf     templates.Renderer
+		expected string
+	}{
+		{templates.Renderer{Template: "a.tmpl", Target: "a"}, ""},
+		{templates.Renderer{Content: "a", Target: "a"}, ""},
+		{templates.Renderer{SourceDir: "src", TargetDir: "out"}, ""},
+		{templates.Renderer{Target: "a"}, "needs one of template, content or source_dir"},
+		{templates.Renderer{Template: "a.tmpl", Content: "a", Target: "a"}, "needs one of template, content or source_dir"},
+		{templates.Renderer{Content: "a"}, "needs a target"},
+		{templates.Renderer{SourceDir: "src", Target: "a"}, "source_dir needs a target_dir"},
+		{templates.Renderer{Content: "a", Target: "a", Partials: "[a"}, "invalid partials"},
+	}
+
+	for _, tc := range tests {
+		err := tc.conf.Check()
+		if tc.expected == "" {
+			if err != nil {
+				t.Errorf("%+v: unexpected error: %s", tc.conf, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%+v: expected an error with %q, got %v", tc.conf, tc.expected, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package util_test
+
+import (
+	"testing"
+
+	"github.com/ionrock/xenv/util"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []byte("one\ntwo\nthree\nfour\n")
+	b := []byte("one\n2\nthree\nfour\nfive\n")
+
+	expected := `--- a
++++ b
+@@ -1,4 +1,5 @@
+ one
+-two
++2
+ three
+ four
++five
+`
+
+	result := util.UnifiedDiff("a", "b", a, b)
+	if result != expected {
+		t.Errorf("wrong diff:\n%s\n!=\n%s", result, expected)
+	}
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	a := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	b := []byte("one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n")
+
+	expected := `--- a
++++ b
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -9,4 +9,4 @@
+ 9
+ 10
+ 11
+-12
++twelve
+`
+
+	result := util.UnifiedDiff("a", "b", a, b)
+	if result != expected {
+		t.Errorf("wrong diff:\n%s\n!=\n%s", result, expected)
+	}
+}
+
+func TestUnifiedDiffNewFile(t *testing.T) {
+	expected := `--- a
++++ b
+@@ -0,0 +1,1 @@
++hello
+`
+
+	result := util.UnifiedDiff("a", "b", nil, []byte("hello\n"))
+	if result != expected {
+		t.Errorf("wrong diff:\n%s\n!=\n%s", result, expected)
+	}
+
+	if util.UnifiedDiff("a", "b", []byte("same"), []byte("same")) != "" {
+		t.Errorf("expected no diff for the same content")
+	}
+}
@@ -24,6 +24,10 @@ func LineReader(wg *sync.WaitGroup, r io.Reader, handler OutHandler) {
 
 		n, err := reader.Read(buf)
 		if err != nil {
+			// The last line may not end with a newline.
+			if buffer.Len() > 0 {
+				handler(buffer.String())
+			}
 			return
 		}
 
@@ -3,6 +3,8 @@ package util_test
 import (
 	"fmt"
 	"os/exec"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 
@@ -32,3 +34,20 @@ func TestLineReader(t *testing.T) {
 		t.Errorf("wrong output: %s != %s", output, expected)
 	}
 }
+
+func TestLineReaderLastLine(t *testing.T) {
+	lines := []string{}
+	outHandler := func(line string) string {
+		lines = append(lines, line)
+		return line
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	util.LineReader(wg, strings.NewReader("one\ntwo"), outHandler)
+
+	expected := []string{"one", "two"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("wrong lines: %q != %q", lines, expected)
+	}
+}
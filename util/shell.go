@@ -0,0 +1,12 @@
+package util
+
+import "os"
+
+// DefaultShell returns the shell commands are run with when none is
+// set. It is /bin/bash -c, or /bin/sh -c where bash isn't installed.
+func DefaultShell() []string {
+	if _, err := os.Stat("/bin/bash"); err == nil {
+		return []string{"/bin/bash", "-c"}
+	}
+	return []string{"/bin/sh", "-c"}
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"os/user"
+	"strconv"
+)
+
+// LookupIDs finds the uid and gid of a user and group, given as a name
+// or an id. An empty owner is the current user and an empty group is
+// the primary group of the user.
+func LookupIDs(owner, group string) (int, int, error) {
+	u, err := user.Current()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if owner != "" {
+		u, err = lookupUser(owner)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	gid := u.Gid
+	if group != "" {
+		g, err := lookupGroup(group)
+		if err != nil {
+			return 0, 0, err
+		}
+		gid = g.Gid
+	}
+
+	uidNum, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	gidNum, err := strconv.Atoi(gid)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return uidNum, gidNum, nil
+}
+
+func lookupUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if _, ok := err.(user.UnknownUserError); ok {
+		if _, numErr := strconv.Atoi(name); numErr == nil {
+			return user.LookupId(name)
+		}
+	}
+	return u, err
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	g, err := user.LookupGroup(name)
+	if _, ok := err.(user.UnknownGroupError); ok {
+		if _, numErr := strconv.Atoi(name); numErr == nil {
+			return user.LookupGroupId(name)
+		}
+	}
+	return g, err
+}
@@ -0,0 +1,49 @@
+package util_test
+
+import (
+	"os/user"
+	"strconv"
+	"testing"
+
+	"github.com/ionrock/xenv/util"
+)
+
+func TestLookupIDs(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, _ := strconv.Atoi(current.Uid)
+	gid, _ := strconv.Atoi(current.Gid)
+
+	tests := []struct {
+		owner, group string
+		uid, gid     int
+	}{
+		{"", "", uid, gid},
+		{current.Username, "", uid, gid},
+		{current.Uid, current.Gid, uid, gid},
+	}
+
+	for _, tc := range tests {
+		u, g, err := util.LookupIDs(tc.owner, tc.group)
+		if err != nil {
+			t.Errorf("error looking up %q %q: %s", tc.owner, tc.group, err)
+			continue
+		}
+
+		if u != tc.uid || g != tc.gid {
+			t.Errorf("wrong ids for %q %q: %d %d", tc.owner, tc.group, u, g)
+		}
+	}
+
+	_, _, err = util.LookupIDs("no-such-user-xenv", "")
+	if err == nil {
+		t.Error("expected an error for an unknown user")
+	}
+
+	_, _, err = util.LookupIDs("", "no-such-group-xenv")
+	if err == nil {
+		t.Error("expected an error for an unknown group")
+	}
+}